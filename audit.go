@@ -0,0 +1,189 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/federation/pkg/dnsprovider"
+)
+
+// Audited operations
+const (
+	AuditAddZone         = "AddZone"
+	AuditRemoveZone      = "RemoveZone"
+	AuditAddRecordSet    = "AddRecordSet"
+	AuditRemoveRecordSet = "RemoveRecordSet"
+	AuditUpsertRecordSet = "UpsertRecordSet"
+)
+
+// Outcomes of audited operations
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent records a DNS mutation made through the provider
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// Subscription is the ID of the subscription holding the zone and
+	// Principal the client ID or managed identity making the change
+	Subscription string `json:"subscription,omitempty"`
+	Principal    string `json:"principal,omitempty"`
+	Zone         string `json:"zone"`
+	// Before is the record set found before the change, nil if it didn't
+	// exist or for zone operations. An addition fails if Before isn't nil.
+	// After is the requested record set.
+	Before  *AuditRecordSet `json:"before,omitempty"`
+	After   *AuditRecordSet `json:"after,omitempty"`
+	Outcome string          `json:"outcome"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// AuditRecordSet is the state of a record set in an AuditEvent
+type AuditRecordSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int64    `json:"ttl"`
+	Rrdatas []string `json:"rrdatas"`
+}
+
+func newAuditRecordSet(rrset dnsprovider.ResourceRecordSet) *AuditRecordSet {
+	if rrset == nil {
+		return nil
+	}
+	return &AuditRecordSet{
+		Name:    rrset.Name(),
+		Type:    string(rrset.Type()),
+		TTL:     rrset.Ttl(),
+		Rrdatas: rrset.Rrdatas(),
+	}
+}
+
+// AuditSink receives an event for every DNS mutation. A failing sink
+// doesn't fail the mutation, which has already been made.
+type AuditSink interface {
+	Record(event AuditEvent) error
+}
+
+// auditing holds the audit sink of an Interface, shared with the Zones
+// created from it. A nil *auditing or sink records nothing.
+type auditing struct {
+	lock sync.RWMutex
+	sink AuditSink
+}
+
+func (a *auditing) setSink(sink AuditSink) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.sink = sink
+}
+
+func (a *auditing) currentSink() AuditSink {
+	if a == nil {
+		return nil
+	}
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.sink
+}
+
+// enabled reports whether events are recorded, the state of record sets
+// before a change is only looked up if so
+func (a *auditing) enabled() bool {
+	return a.currentSink() != nil
+}
+
+// record completes event with the time and outcome of err and records it
+func (a *auditing) record(event AuditEvent, err error) {
+	sink := a.currentSink()
+	if sink == nil {
+		return
+	}
+
+	event.Time = time.Now().UTC()
+	event.Outcome = AuditSuccess
+	if err != nil {
+		event.Outcome = AuditFailure
+		event.Error = err.Error()
+	}
+	if err := sink.Record(event); err != nil {
+		withFields(fieldZone, event.Zone, fieldOperation, event.Operation).error("Could not record audit event", err)
+	}
+}
+
+// MemoryAuditSink keeps the audit events in memory
+type MemoryAuditSink struct {
+	lock   sync.Mutex
+	events []AuditEvent
+}
+
+// Record appends event to the recorded events
+func (s *MemoryAuditSink) Record(event AuditEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the recorded events in order
+func (s *MemoryAuditSink) Events() []AuditEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]AuditEvent(nil), s.events...)
+}
+
+// FileAuditSink appends the audit events to a file, one JSON object per line
+type FileAuditSink struct {
+	lock   sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	closed bool
+}
+
+// NewFileAuditSink opens the JSON lines file at path for appending,
+// creating it if necessary
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return &FileAuditSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Record appends event as a line to the file
+func (s *FileAuditSink) Record(event AuditEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.enc.Encode(event)
+}
+
+// Close closes the file, closing it again does nothing
+func (s *FileAuditSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.file.Close()
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
+	"k8s.io/kubernetes/federation/pkg/dnsprovider/rrstype"
+)
+
+/* TestAuditMutations verifies the events recorded for zone and record set changes */
+func TestAuditMutations(t *testing.T) {
+	iface := &Interface{service: azurestub.NewAPIStub()}
+	// the sink applies to the Zones taken before it was set
+	zones, _ := iface.Zones()
+	sink := &MemoryAuditSink{}
+	iface.SetAuditSink(sink)
+
+	input, _ := zones.New("audit.test")
+	zone, err := zones.Add(input)
+	if err != nil {
+		t.Fatalf("Failed to add zone: %v", err)
+	}
+	rrsets, _ := zone.ResourceRecordSets()
+	if err := rrsets.StartChangeset().Add(rrsets.New("www.audit.test", []string{"10.0.0.1"}, 180, rrstype.A)).Apply(); err != nil {
+		t.Fatalf("Failed to add record set: %v", err)
+	}
+	if err := rrsets.StartChangeset().Upsert(rrsets.New("api.audit.test", []string{"10.0.0.2"}, 300, rrstype.A)).Apply(); err != nil {
+		t.Fatalf("Failed to upsert record set: %v", err)
+	}
+	if err := rrsets.StartChangeset().Remove(rrsets.New("www.audit.test", []string{"10.0.0.1"}, 180, rrstype.A)).Apply(); err != nil {
+		t.Fatalf("Failed to remove record set: %v", err)
+	}
+	if err := zones.Remove(zone); err != nil {
+		t.Fatalf("Failed to remove zone: %v", err)
+	}
+
+	events := sink.Events()
+	var operations []string
+	for _, event := range events {
+		operations = append(operations, event.Operation)
+		if event.Zone != "audit.test" || event.Outcome != AuditSuccess || event.Time.IsZero() {
+			t.Errorf("Got event %+v, expected a successful change of zone audit.test", event)
+		}
+	}
+	want := []string{AuditAddZone, AuditAddRecordSet, AuditUpsertRecordSet, AuditRemoveRecordSet, AuditRemoveZone}
+	if !reflect.DeepEqual(operations, want) {
+		t.Fatalf("Got operations %v, expected %v", operations, want)
+	}
+
+	added := &AuditRecordSet{Name: "www.audit.test", Type: "A", TTL: 180, Rrdatas: []string{"10.0.0.1"}}
+	if events[1].Before != nil || !reflect.DeepEqual(events[1].After, added) {
+		t.Errorf("Got before %+v and after %+v for the addition, expected nil and %+v", events[1].Before, events[1].After, added)
+	}
+	upserted := &AuditRecordSet{Name: "api.audit.test", Type: "A", TTL: 300, Rrdatas: []string{"10.0.0.2"}}
+	if events[2].Before != nil || !reflect.DeepEqual(events[2].After, upserted) {
+		t.Errorf("Got before %+v and after %+v for the upsert, expected nil and %+v", events[2].Before, events[2].After, upserted)
+	}
+	if !reflect.DeepEqual(events[3].Before, added) || events[3].After != nil {
+		t.Errorf("Got before %+v and after %+v for the removal, expected %+v and nil", events[3].Before, events[3].After, added)
+	}
+}
+
+/* TestFileAuditSink verifies that events are appended as JSON lines */
+func TestFileAuditSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "azuredns")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	audit := &auditing{sink: sink}
+	audit.record(AuditEvent{Operation: AuditAddZone, Zone: "a.test"}, nil)
+	audit.record(AuditEvent{Operation: AuditRemoveZone, Zone: "b.test"}, errors.New("conflict"))
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Failed to close audit log: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer f.Close()
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Got %d events, expected 2", len(events))
+	}
+	if events[1].Zone != "b.test" || events[1].Outcome != AuditFailure || events[1].Error != "conflict" {
+		t.Errorf("Got event %+v, expected the failed removal of b.test", events[1])
+	}
+}
+
+/* TestAuditAdditionConflict verifies that an addition colliding with an existing record set records it as Before */
+func TestAuditAdditionConflict(t *testing.T) {
+	iface := &Interface{service: azurestub.NewAPIStub()}
+	sink := &MemoryAuditSink{}
+	iface.SetAuditSink(sink)
+
+	zones, _ := iface.Zones()
+	input, _ := zones.New("audit.test")
+	zone, err := zones.Add(input)
+	if err != nil {
+		t.Fatalf("Failed to add zone: %v", err)
+	}
+	rrsets, _ := zone.ResourceRecordSets()
+	if err := rrsets.StartChangeset().Add(rrsets.New("www.audit.test", []string{"10.0.0.1"}, 180, rrstype.A)).Apply(); err != nil {
+		t.Fatalf("Failed to add record set: %v", err)
+	}
+	if err := rrsets.StartChangeset().Add(rrsets.New("www.audit.test", []string{"10.0.0.2"}, 180, rrstype.A)).Apply(); err == nil {
+		t.Fatalf("Expected adding an existing record set to fail")
+	}
+
+	events := sink.Events()
+	last := events[len(events)-1]
+	existing := &AuditRecordSet{Name: "www.audit.test", Type: "A", TTL: 180, Rrdatas: []string{"10.0.0.1"}}
+	if last.Outcome != AuditFailure || !reflect.DeepEqual(last.Before, existing) {
+		t.Errorf("Got event %+v, expected the failed addition with the existing record set as before", last)
+	}
+}
+
+/* TestAuditBeforeUncached verifies that the prior state is read from Azure, not from the cache */
+func TestAuditBeforeUncached(t *testing.T) {
+	stub := azurestub.NewAPIStub()
+	iface := &Interface{service: newCacheAPI(stub, time.Hour, nil)}
+	sink := &MemoryAuditSink{}
+	iface.SetAuditSink(sink)
+
+	zones, _ := iface.Zones()
+	input, _ := zones.New("audit.test")
+	zone, err := zones.Add(input)
+	if err != nil {
+		t.Fatalf("Failed to add zone: %v", err)
+	}
+	rrsets, _ := zone.ResourceRecordSets()
+	if err := rrsets.StartChangeset().Add(rrsets.New("www.audit.test", []string{"10.0.0.1"}, 180, rrstype.A)).Apply(); err != nil {
+		t.Fatalf("Failed to add record set: %v", err)
+	}
+	if _, err := rrsets.Get("www.audit.test"); err != nil {
+		t.Fatalf("Failed to get record set: %v", err)
+	}
+	// changed in Azure by someone else, the cache still has 10.0.0.1
+	changed := rrsets.New("www.audit.test", []string{"10.0.0.3"}, 180, rrstype.A).(ResourceRecordSet).toRecordSet()
+	stub.CreateOrUpdateRecordSet("audit.test", "www", dns.A, *changed, "", "")
+
+	if err := rrsets.StartChangeset().Upsert(rrsets.New("www.audit.test", []string{"10.0.0.2"}, 180, rrstype.A)).Apply(); err != nil {
+		t.Fatalf("Failed to upsert record set: %v", err)
+	}
+	events := sink.Events()
+	last := events[len(events)-1]
+	if want := (&AuditRecordSet{Name: "www.audit.test", Type: "A", TTL: 180, Rrdatas: []string{"10.0.0.3"}}); !reflect.DeepEqual(last.Before, want) {
+		t.Errorf("Got before %+v for the upsert, expected %+v", last.Before, want)
+	}
+}
+
+/* TestAuditLogClosed verifies that Close closes the audit log opened from the config */
+func TestAuditLogClosed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "azuredns")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	iface, closeAll := newARMTestInterface(t, "audit-log-file = "+filepath.Join(dir, "audit.log")+"\n", nil)
+	defer closeAll()
+	if err := iface.Close(); err != nil {
+		t.Fatalf("Failed to close interface: %v", err)
+	}
+	if err := iface.auditFile.Record(AuditEvent{Operation: AuditAddZone}); err == nil {
+		t.Errorf("Expected recording to the closed audit log to fail")
+	}
+	if err := iface.Close(); err != nil {
+		t.Errorf("Got %v closing again, expected nothing to do", err)
+	}
+}
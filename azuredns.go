@@ -18,10 +18,15 @@ limitations under the License.
 package azuredns
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
-	//"bytes"
-	"github.com/golang/glog"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
 	gcfg "gopkg.in/gcfg.v1"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
 )
@@ -33,7 +38,10 @@ const (
 )
 
 // Config holds the parameters from the
-// dns-provider-config file
+// dns-provider-config file.
+// Subscription, tenant, service principal and resource group values the file
+// omits are read from the AZURE_* environment variables and then from
+// $HOME/.azure/credentials.json, see loadCredentials.
 type Config struct {
 	Global struct {
 		SubscriptionID string `gcfg:"subscription-id"`
@@ -41,42 +49,378 @@ type Config struct {
 		Secret         string `gcfg:"secret"`
 		TenantID       string `gcfg:"tenant-id"`
 		ResourceGroup  string `gcfg:"resourceGroup"`
+
+		// ResourceGroups adds resource groups whose zones are managed besides
+		// ResourceGroup, one per line. New zones are created in ResourceGroup.
+		// SubscriptionWideZones manages the zones of all resource groups in the
+		// subscription instead, ResourceGroup is then only needed to create
+		// zones. Requests for a listed zone are sent to its own resource group.
+		ResourceGroups        []string `gcfg:"resource-groups"`
+		SubscriptionWideZones bool     `gcfg:"subscription-wide-zones"`
+
+		// Cloud selects the Azure environment: AzurePublicCloud (default),
+		// AzureChinaCloud, AzureUSGovernmentCloud or AzureGermanCloud.
+		// Environment is accepted as an alias.
+		Cloud       string `gcfg:"cloud"`
+		Environment string `gcfg:"environment"`
+
+		// PKCS#12 certificate for service principals without a client secret
+		ClientCertificatePath     string `gcfg:"client-certificate-path"`
+		ClientCertificatePassword string `gcfg:"client-certificate-password"`
+
+		// Authenticate with the managed identity of the host instead of a
+		// service principal secret. Leave the identity ID empty to use the
+		// system assigned identity. The endpoint defaults to the instance
+		// metadata service.
+		UseManagedIdentity      bool   `gcfg:"use-managed-identity"`
+		UserAssignedIdentityID  string `gcfg:"user-assigned-identity-id"`
+		ManagedIdentityEndpoint string `gcfg:"managed-identity-endpoint"`
+
+		// SecretFile names a file holding the service principal secret.
+		// The secret file and WatchConfigFile, the path of this config, are
+		// polled every ReloadInterval (default 30s) and the credentials are
+		// reloaded when either changes.
+		SecretFile      string `gcfg:"secret-file"`
+		WatchConfigFile string `gcfg:"watch-config-file"`
+		ReloadInterval  string `gcfg:"reload-interval"`
+
+		// Retry policy for throttled (429) and transient ARM errors.
+		// Delays double from retry-base-delay (1s) up to retry-max-delay (30s),
+		// randomized by the retry-jitter fraction (0.2, negative disables). The Retry-After header
+		// takes precedence unless ignore-retry-after is set. Defaults to 5 attempts.
+		RetryMaxAttempts int     `gcfg:"retry-max-attempts"`
+		RetryBaseDelay   string  `gcfg:"retry-base-delay"`
+		RetryMaxDelay    string  `gcfg:"retry-max-delay"`
+		RetryJitter      float64 `gcfg:"retry-jitter"`
+		IgnoreRetryAfter bool    `gcfg:"ignore-retry-after"`
+
+		// Client side limits of ARM read and write requests per second,
+		// unlimited if not set
+		ReadsPerSecond  float64 `gcfg:"reads-per-second"`
+		WritesPerSecond float64 `gcfg:"writes-per-second"`
+
+		// RequestTimeout bounds each ARM call made without a deadline,
+		// including its retries and the polling of long running
+		// operations (default 5m)
+		RequestTimeout string `gcfg:"request-timeout"`
+
+		// CacheTTL enables caching the zones and record sets read from ARM for
+		// the duration. Writes through the provider invalidate the cached
+		// record sets of their zone. CacheResyncInterval additionally rereads
+		// all zones and record sets periodically.
+		CacheTTL            string `gcfg:"cache-ttl"`
+		CacheResyncInterval string `gcfg:"cache-resync-interval"`
+
+		// AuditLogFile appends an audit event for every zone and record set
+		// mutation to the file, one JSON object per line
+		AuditLogFile string `gcfg:"audit-log-file"`
+
+		// Endpoint overrides, e.g. for Azure Stack
+		ResourceManagerEndpoint string `gcfg:"resource-manager-endpoint"`
+		ActiveDirectoryEndpoint string `gcfg:"active-directory-endpoint"`
+	}
+
+	// Subscription sections, [Subscription "name"], each manage the zones of
+	// one subscription. When present, [Global] is not a subscription itself
+	// but holds the defaults of the sections. New zones are added to the
+	// first subscription by name.
+	Subscription map[string]*SubscriptionConfig
+
+	// name of the subscription section this config was derived from
+	name string
+	// subscriptionConfigs holds the validated configs of the sections
+	subscriptionConfigs []Config
+}
+
+// SubscriptionConfig holds the settings of a [Subscription "name"] section
+// that override the [Global] ones
+type SubscriptionConfig struct {
+	SubscriptionID string   `gcfg:"subscription-id"`
+	TenantID       string   `gcfg:"tenant-id"`
+	ClientID       string   `gcfg:"client-id"`
+	ResourceGroup  string   `gcfg:"resourceGroup"`
+	ResourceGroups []string `gcfg:"resource-groups"`
+
+	SubscriptionWideZones bool `gcfg:"subscription-wide-zones"`
+
+	// Setting any of these replaces all of the [Global] credentials
+	Secret                    string `gcfg:"secret"`
+	SecretFile                string `gcfg:"secret-file"`
+	ClientCertificatePath     string `gcfg:"client-certificate-path"`
+	ClientCertificatePassword string `gcfg:"client-certificate-password"`
+	UseManagedIdentity        bool   `gcfg:"use-managed-identity"`
+	UserAssignedIdentityID    string `gcfg:"user-assigned-identity-id"`
+}
+
+// subscriptionNames returns the names of the subscription sections in order
+func (c Config) subscriptionNames() []string {
+	names := make([]string, 0, len(c.Subscription))
+	for name := range c.Subscription {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forSubscription returns the config of the named subscription section
+// with the defaults from [Global] applied
+func (c Config) forSubscription(name string) (Config, error) {
+	sub := c.Subscription[name]
+	if sub == nil || sub.SubscriptionID == "" {
+		return c, fmt.Errorf("%w: subscription %q: subscription-id not set", ErrInvalidConfig, name)
+	}
+
+	config := Config{Global: c.Global, name: name}
+	global := &config.Global
+	global.SubscriptionID = sub.SubscriptionID
+	if sub.TenantID != "" {
+		global.TenantID = sub.TenantID
+	}
+	if sub.ClientID != "" {
+		global.ClientID = sub.ClientID
+	}
+	if sub.ResourceGroup != "" {
+		global.ResourceGroup = sub.ResourceGroup
+		global.ResourceGroups = nil
+	}
+	global.ResourceGroups = append(global.ResourceGroups, sub.ResourceGroups...)
+	global.SubscriptionWideZones = global.SubscriptionWideZones || sub.SubscriptionWideZones
+
+	if sub.Secret != "" || sub.SecretFile != "" || sub.ClientCertificatePath != "" || sub.UseManagedIdentity {
+		global.Secret = sub.Secret
+		global.SecretFile = sub.SecretFile
+		global.ClientCertificatePath = sub.ClientCertificatePath
+		global.ClientCertificatePassword = sub.ClientCertificatePassword
+		global.UseManagedIdentity = sub.UseManagedIdentity
+		global.UserAssignedIdentityID = sub.UserAssignedIdentityID
+	}
+	return config, nil
+}
+
+// requiresResourceGroup reports whether a managed subscription needs the
+// [Global] resourceGroup, which is optional for subscription-wide zones
+func (c Config) requiresResourceGroup() bool {
+	if c.Global.SubscriptionWideZones {
+		return false
+	}
+	if len(c.Subscription) == 0 {
+		return true
+	}
+	for _, sub := range c.Subscription {
+		if !sub.SubscriptionWideZones && sub.ResourceGroup == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptions returns the config of each managed subscription,
+// the config itself if it has no subscription sections
+func (c Config) subscriptions() ([]Config, error) {
+	if len(c.Subscription) == 0 {
+		return []Config{c}, nil
+	}
+	if len(c.subscriptionConfigs) > 0 {
+		return c.subscriptionConfigs, nil
 	}
+
+	var configs []Config
+	for _, name := range c.subscriptionNames() {
+		config, err := c.forSubscription(name)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// subscription returns the config of the named subscription section,
+// the config itself for the empty name
+func (c Config) subscription(name string) (Config, error) {
+	configs, err := c.subscriptions()
+	if err != nil {
+		return c, err
+	}
+	for _, config := range configs {
+		if config.name == name {
+			return config, nil
+		}
+	}
+	return c, fmt.Errorf("%w: subscription %q not found", ErrInvalidConfig, name)
+}
+
+// resourceGroups returns the resource groups whose zones are managed,
+// the default resource group first
+func (c Config) resourceGroups() []string {
+	groups := []string{c.Global.ResourceGroup}
+	for _, rg := range c.Global.ResourceGroups {
+		duplicate := false
+		for _, g := range groups {
+			duplicate = duplicate || strings.EqualFold(g, rg)
+		}
+		if rg != "" && !duplicate {
+			groups = append(groups, rg)
+		}
+	}
+	return groups
+}
+
+// cloudProviderConfig holds the parameters read from the Kubernetes Azure
+// cloud provider config (/etc/kubernetes/azure.json)
+type cloudProviderConfig struct {
+	Cloud                       string `json:"cloud"`
+	TenantID                    string `json:"tenantId"`
+	SubscriptionID              string `json:"subscriptionId"`
+	ResourceGroup               string `json:"resourceGroup"`
+	AADClientID                 string `json:"aadClientId"`
+	AADClientSecret             string `json:"aadClientSecret"`
+	AADClientCertPath           string `json:"aadClientCertPath"`
+	AADClientCertPassword       string `json:"aadClientCertPassword"`
+	UseManagedIdentityExtension bool   `json:"useManagedIdentityExtension"`
+	UserAssignedIdentityID      string `json:"userAssignedIdentityID"`
+}
+
+// readConfig reads the dns-provider-config, which is either in gcfg format
+// or the JSON format of the Kubernetes Azure cloud provider.
+// JSON is detected by the leading '{'.
+func readConfig(config io.Reader) (Config, error) {
+	var azConfig Config
+
+	b, err := ioutil.ReadAll(config)
+	if err != nil {
+		return azConfig, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		err = gcfg.ReadStringInto(&azConfig, string(b))
+		return azConfig, err
+	}
+
+	var cpConfig cloudProviderConfig
+	if err := json.Unmarshal(b, &cpConfig); err != nil {
+		return azConfig, err
+	}
+
+	azConfig.Global.Cloud = cpConfig.Cloud
+	azConfig.Global.TenantID = cpConfig.TenantID
+	azConfig.Global.SubscriptionID = cpConfig.SubscriptionID
+	azConfig.Global.ResourceGroup = cpConfig.ResourceGroup
+	azConfig.Global.ClientID = cpConfig.AADClientID
+	// Like the cloud provider, prefer the managed identity over the service
+	// principal if both are configured
+	if cpConfig.UseManagedIdentityExtension {
+		azConfig.Global.UseManagedIdentity = true
+		azConfig.Global.UserAssignedIdentityID = cpConfig.UserAssignedIdentityID
+	} else {
+		azConfig.Global.Secret = cpConfig.AADClientSecret
+		azConfig.Global.ClientCertificatePath = cpConfig.AADClientCertPath
+		azConfig.Global.ClientCertificatePassword = cpConfig.AADClientCertPassword
+	}
+	return azConfig, nil
 }
 
 func init() {
 	dnsprovider.RegisterDnsProvider(ProviderName, func(config io.Reader) (dnsprovider.Interface, error) {
-		glog.V(5).Infof("Registering Azure DNS provider\n")
-		return newazuredns(config)
+		logger{}.info(5, "Creating the Azure DNS provider")
+		iface, err := newazuredns(config)
+		if err != nil {
+			// don't return a typed nil pointer
+			return nil, err
+		}
+		return iface, nil
 	})
 }
 
 // newazuredns creates a new instance of an AWS azuredns DNS Interface.
 func newazuredns(config io.Reader) (*Interface, error) {
-
-	var azConfig Config
-	if err := gcfg.ReadInto(&azConfig, config); err != nil {
-		glog.Errorf("Couldn't read config: %v", err)
+	azConfig, err := loadConfig(config)
+	if err != nil {
 		return nil, err
 	}
 
-	glog.V(4).Infof("Azure DNS config: %v", azConfig)
+	return New(azConfig)
+}
+
+// loadConfig reads and validates the dns-provider-config
+func loadConfig(config io.Reader) (Config, error) {
+	azConfig, err := readConfig(config)
+	if err != nil {
+		logger{}.error("Could not read the config", err)
+		return azConfig, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// Config.String redacts the secrets
+	withFields("config", azConfig).info(4, "Loaded config")
 
-	if azConfig.Global.ResourceGroup == "" {
-		return nil, fmt.Errorf("No Azure Resource Group for Azure DNS configured")
+	durations := map[string]string{
+		"reload-interval":       azConfig.Global.ReloadInterval,
+		"retry-base-delay":      azConfig.Global.RetryBaseDelay,
+		"retry-max-delay":       azConfig.Global.RetryMaxDelay,
+		"request-timeout":       azConfig.Global.RequestTimeout,
+		"cache-ttl":             azConfig.Global.CacheTTL,
+		"cache-resync-interval": azConfig.Global.CacheResyncInterval,
+	}
+	for key, value := range durations {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return azConfig, fmt.Errorf("%w: %s %q: %v", ErrInvalidConfig, key, value, err)
+		}
 	}
 
-	if azConfig.Global.ClientID == "" || azConfig.Global.Secret == "" {
-		return nil, fmt.Errorf("Incorrect AAD Service Principal credentials. Check  az ad sp create-for-rbac for help")
+	if len(azConfig.Subscription) == 0 {
+		return loadSubscriptionConfig(azConfig)
+	}
+
+	for _, name := range azConfig.subscriptionNames() {
+		config, err := azConfig.forSubscription(name)
+		if err == nil {
+			config, err = loadSubscriptionConfig(config)
+		}
+		if err != nil {
+			return azConfig, fmt.Errorf("subscription %q: %w", name, err)
+		}
+		azConfig.subscriptionConfigs = append(azConfig.subscriptionConfigs, config)
+	}
+	return azConfig, nil
+}
+
+// loadSubscriptionConfig reads the secret file and the missing credentials
+// of a subscription and validates them
+func loadSubscriptionConfig(azConfig Config) (Config, error) {
+	var err error
+	if azConfig.Global.SecretFile != "" {
+		if azConfig.Global.Secret != "" {
+			return azConfig, fmt.Errorf("%w: only one of secret or secret-file may be configured", ErrInvalidConfig)
+		}
+		if azConfig.Global.Secret, err = readSecretFile(azConfig.Global.SecretFile); err != nil {
+			return azConfig, err
+		}
+	}
+
+	credentialTypes := 0
+	if azConfig.Global.Secret != "" {
+		credentialTypes++
+	}
+	if azConfig.Global.ClientCertificatePath != "" {
+		credentialTypes++
+	}
+	if azConfig.Global.UseManagedIdentity {
+		credentialTypes++
+	}
+	if credentialTypes > 1 {
+		return azConfig, fmt.Errorf("%w: only one of secret, client-certificate-path or use-managed-identity may be configured", ErrInvalidConfig)
 	}
 
-	if azConfig.Global.TenantID == "" {
-		return nil, fmt.Errorf("Missing AAD Tenant ID")
+	if err := loadCredentials(&azConfig); err != nil {
+		return azConfig, err
 	}
 
-	if azConfig.Global.SubscriptionID == "" {
-		return nil, fmt.Errorf("Missing Azure Subscription ID")
+	if _, err := azureEnvironment(azConfig); err != nil {
+		return azConfig, err
 	}
 
-	return New(azConfig), nil
+	return azConfig, nil
 }
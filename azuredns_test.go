@@ -18,14 +18,23 @@ package azuredns
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
+	"golang.org/x/time/rate"
 
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
 	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
@@ -57,7 +66,7 @@ func newAzureDNSProvider() (dnsprovider.Interface, error) {
 		os.Exit(1)
 	}
 
-	i, err := dnsprovider.GetDnsProvider(ProviderName, configString)
+	i, err := dnsprovider.GetDnsProvider(ProviderName, strings.NewReader(configString))
 	if i == nil || err != nil {
 		fmt.Printf("DNS provider %s not registered", ProviderName)
 		os.Exit(1)
@@ -428,6 +437,194 @@ func TestResourceRecordSetsRemoveGone(t *testing.T) {
 	}
 }
 
+/* TestResourceRecordSetsTXT verifies that TXT record sets round-trip and invalid ones are rejected by Apply */
+func TestResourceRecordSetsTXT(t *testing.T) {
+	zone := firstZone(t)
+	sets := rrs(t, zone)
+	long := strings.Repeat("x", 400)
+	rrset := sets.New("txt."+zone.Name(), []string{`"v=spf1 -all"`, long}, 180, rrstype.RrsType("TXT"))
+	addRrsetOrFail(t, sets, rrset)
+	defer sets.StartChangeset().Remove(rrset).Apply()
+
+	found, err := sets.Get(rrset.Name())
+	if err != nil || len(found) != 1 {
+		t.Fatalf("Got %v (%v), expected the TXT record set", found, err)
+	}
+	if want := []string{"v=spf1 -all", long}; !reflect.DeepEqual(found[0].Rrdatas(), want) {
+		t.Errorf("Got rrdatas %q, expected %q", found[0].Rrdatas(), want)
+	}
+
+	invalid := sets.New("bad."+zone.Name(), []string{`"unterminated`}, 180, rrstype.RrsType("TXT"))
+	if err := sets.StartChangeset().Add(invalid).Apply(); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("Got error %v adding an invalid TXT record set, expected ErrInvalidRecord", err)
+	}
+}
+
+/* TestResourceRecordSetsSRV verifies that SRV record sets round-trip through New, Apply and Get */
+func TestResourceRecordSetsSRV(t *testing.T) {
+	zone := firstZone(t)
+	sets := rrs(t, zone)
+	rrset := sets.New("_sip._tcp."+zone.Name(), []string{"10 5 5060 sip.example.com"}, 180, rrstype.RrsType("SRV"))
+	want := []string{"10 5 5060 sip.example.com."}
+	if !reflect.DeepEqual(rrset.Rrdatas(), want) {
+		t.Errorf("Got rrdatas %q from New, expected %q", rrset.Rrdatas(), want)
+	}
+	addRrsetOrFail(t, sets, rrset)
+	defer sets.StartChangeset().Remove(rrset).Apply()
+
+	found, err := sets.Get(rrset.Name())
+	if err != nil || len(found) != 1 {
+		t.Fatalf("Got %v (%v), expected the SRV record set", found, err)
+	}
+	if !reflect.DeepEqual(found[0].Rrdatas(), want) {
+		t.Errorf("Got rrdatas %q, expected %q", found[0].Rrdatas(), want)
+	}
+}
+
+/* TestResourceRecordSetsGetApex verifies that record sets at the zone apex are found by the zone name */
+func TestResourceRecordSetsGetApex(t *testing.T) {
+	zone := firstZone(t)
+	sets := rrs(t, zone)
+	rrset := sets.New(zone.Name(), []string{"10 mail." + zone.Name() + "."}, 180, rrstype.RrsType("MX"))
+	if rrset.Name() != "@" {
+		t.Errorf("Got name %q for the apex record set, expected @", rrset.Name())
+	}
+	addRrsetOrFail(t, sets, rrset)
+	defer sets.StartChangeset().Remove(rrset).Apply()
+
+	for _, name := range []string{zone.Name(), zone.Name() + ".", "@"} {
+		found, err := sets.Get(name)
+		if err != nil || len(found) != 1 || found[0].Type() != rrstype.RrsType("MX") {
+			t.Errorf("Got %v (%v) for %s, expected the apex MX record set", found, err, name)
+		}
+	}
+}
+
+/* TestResourceRecordSetsUpsertReplaces verifies that an upsert replaces an existing RRS */
+func TestResourceRecordSetsUpsertReplaces(t *testing.T) {
+	zone := firstZone(t)
+	sets := rrs(t, zone)
+	rrset := getExampleRrs(zone)
+	addRrsetOrFail(t, sets, rrset)
+	replacement := sets.New(rrset.Name(), []string{"10.10.10.11"}, 300, rrstype.A)
+	defer sets.StartChangeset().Remove(replacement).Apply()
+
+	if err := sets.StartChangeset().Upsert(replacement).Apply(); err != nil {
+		t.Fatalf("Failed to upsert over the existing resource record set: %v", err)
+	}
+	found, err := sets.Get(rrset.Name())
+	if err != nil || len(found) != 1 {
+		t.Fatalf("Got %v (%v), expected the upserted record set", found, err)
+	}
+	if !reflect.DeepEqual(found[0].Rrdatas(), []string{"10.10.10.11"}) || found[0].Ttl() != 300 {
+		t.Errorf("Got rrdatas %v with TTL %d, expected the upserted ones", found[0].Rrdatas(), found[0].Ttl())
+	}
+}
+
+/* TestZonesAddDelegated verifies that an added child zone is delegated from its parent zone */
+func TestZonesAddDelegated(t *testing.T) {
+	iface := &Interface{service: azurestub.NewAPIStub()}
+	z, _ := iface.Zones()
+	zones := z.(Zones)
+	for _, name := range []string{"example.com", "fed.example.com"} {
+		input, _ := zones.New(name)
+		if _, err := zones.Add(input); err != nil {
+			t.Fatalf("Failed to add zone %s: %v", name, err)
+		}
+	}
+
+	input, _ := zones.New("eu.fed.example.com")
+	// delegating again replaces the NS record set
+	for i := 0; i < 2; i++ {
+		child, err := zones.AddDelegated(input)
+		if err != nil {
+			t.Fatalf("Failed to add delegated zone: %v", err)
+		}
+		if len(child.(*Zone).NameServers()) == 0 {
+			t.Fatalf("Added zone %s has no name servers", child.Name())
+		}
+	}
+
+	parent, err := zones.parentZone("eu.fed.example.com")
+	if err != nil || parent.Name() != "fed.example.com" {
+		t.Fatalf("Got parent zone %v (%v), expected fed.example.com", parent, err)
+	}
+	found, err := rrs(t, parent).Get("eu.fed.example.com")
+	if err != nil || len(found) != 1 || found[0].Type() != rrstype.RrsType("NS") {
+		t.Fatalf("Got %v (%v), expected the NS record set in the parent zone", found, err)
+	}
+	if want := []string{"ns1-01.azure-dns.com.", "ns2-01.azure-dns.net."}; !reflect.DeepEqual(found[0].Rrdatas(), want) {
+		t.Errorf("Got name servers %q, expected %q", found[0].Rrdatas(), want)
+	}
+
+	orphan, _ := zones.New("other.test")
+	if _, err := zones.AddDelegated(orphan); !errors.Is(err, ErrParentZoneNotFound) {
+		t.Errorf("Got error %v delegating a zone without parent, expected ErrParentZoneNotFound", err)
+	}
+}
+
+/* TestZonesUpsertReverseRecords verifies that PTR records are upserted into the managed reverse zones */
+func TestZonesUpsertReverseRecords(t *testing.T) {
+	iface := &Interface{service: azurestub.NewAPIStub()}
+	z, _ := iface.Zones()
+	zones := z.(Zones)
+	for _, name := range []string{"example.com", "0.10.in-addr.arpa", "8.b.d.0.1.0.0.2.ip6.arpa"} {
+		input, _ := zones.New(name)
+		if _, err := zones.Add(input); err != nil {
+			t.Fatalf("Failed to add zone %s: %v", name, err)
+		}
+	}
+	list, _ := zones.List()
+	zoneNamed := func(name string) dnsprovider.Zone {
+		for _, zone := range list {
+			if zone.Name() == name {
+				return zone
+			}
+		}
+		t.Fatalf("Missing zone %s", name)
+		return nil
+	}
+	sets := rrs(t, zoneNamed("example.com"))
+
+	// 192.168.0.1 has no managed reverse zone and is skipped
+	a := sets.New("www.example.com", []string{"10.0.1.2", "192.168.0.1"}, 300, rrstype.A)
+	aaaa := sets.New("www.example.com", []string{"2001:db8::1"}, 300, rrstype.AAAA)
+	for _, rrset := range []dnsprovider.ResourceRecordSet{a, aaaa, a} {
+		if err := zones.UpsertReverseRecords(rrset); err != nil {
+			t.Fatalf("Failed to upsert the reverse records of %v: %v", rrset.Rrdatas(), err)
+		}
+	}
+
+	for zone, name := range map[string]string{
+		"0.10.in-addr.arpa":        "2.1.0.10.in-addr.arpa",
+		"8.b.d.0.1.0.0.2.ip6.arpa": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+	} {
+		found, err := rrs(t, zoneNamed(zone)).Get(name)
+		if err != nil || len(found) != 1 {
+			t.Errorf("Got %v (%v), expected the PTR record set %s", found, err, name)
+			continue
+		}
+		if found[0].Type() != rrstype.RrsType("PTR") || !reflect.DeepEqual(found[0].Rrdatas(), []string{"www.example.com."}) || found[0].Ttl() != 300 {
+			t.Errorf("Got %s record set %v with TTL %d, expected a PTR to www.example.com.", found[0].Type(), found[0].Rrdatas(), found[0].Ttl())
+		}
+	}
+
+	// the PTR target of an apex record set is the zone name
+	apex := sets.New("example.com", []string{"10.0.1.3"}, 300, rrstype.A)
+	if err := zones.UpsertReverseRecords(apex); err != nil {
+		t.Fatalf("Failed to upsert the reverse records of the apex: %v", err)
+	}
+	found, err := rrs(t, zoneNamed("0.10.in-addr.arpa")).Get("3.1.0.10.in-addr.arpa")
+	if err != nil || len(found) != 1 || !reflect.DeepEqual(found[0].Rrdatas(), []string{"example.com."}) {
+		t.Errorf("Got %v (%v), expected a PTR to example.com.", found, err)
+	}
+
+	cname := sets.New("alias.example.com", []string{"www.example.com"}, 300, rrstype.CNAME)
+	if err := zones.UpsertReverseRecords(cname); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("Got error %v for a CNAME record set, expected ErrInvalidRecord", err)
+	}
+}
+
 func TestResourceRecordSetPaging(t *testing.T) {
 	count := 10
 	zone := firstZone(t)
@@ -478,3 +675,517 @@ func TestResourceRecordSetsDifferentTypes(t *testing.T) {
 	zone := firstZone(t)
 	tests.CommonTestResourceRecordSetsDifferentTypes(t, zone)
 }
+
+/* TestAzureEnvironment verifies the selection of sovereign clouds and endpoint overrides */
+func TestAzureEnvironment(t *testing.T) {
+	tests := []struct {
+		cloud, environment, rmEndpoint, aadEndpoint string
+		wantRM, wantAAD                             string
+	}{
+		{"", "", "", "", azure.PublicCloud.ResourceManagerEndpoint, azure.PublicCloud.ActiveDirectoryEndpoint},
+		{"AzureChinaCloud", "", "", "", azure.ChinaCloud.ResourceManagerEndpoint, azure.ChinaCloud.ActiveDirectoryEndpoint},
+		{"", "AzureUSGovernmentCloud", "", "", azure.USGovernmentCloud.ResourceManagerEndpoint, azure.USGovernmentCloud.ActiveDirectoryEndpoint},
+		{"azuregermancloud", "", "", "", azure.GermanCloud.ResourceManagerEndpoint, azure.GermanCloud.ActiveDirectoryEndpoint},
+		{"", "", "https://management.local.azurestack.external/", "https://adfs.local.azurestack.external/", "https://management.local.azurestack.external/", "https://adfs.local.azurestack.external/"},
+	}
+
+	for _, test := range tests {
+		var config Config
+		config.Global.Cloud = test.cloud
+		config.Global.Environment = test.environment
+		config.Global.ResourceManagerEndpoint = test.rmEndpoint
+		config.Global.ActiveDirectoryEndpoint = test.aadEndpoint
+
+		env, err := azureEnvironment(config)
+		if err != nil {
+			t.Errorf("Unexpected error for %+v: %v", test, err)
+			continue
+		}
+		if env.ResourceManagerEndpoint != test.wantRM {
+			t.Errorf("Resource manager endpoint %q, expected %q", env.ResourceManagerEndpoint, test.wantRM)
+		}
+		if env.ActiveDirectoryEndpoint != test.wantAAD {
+			t.Errorf("Active directory endpoint %q, expected %q", env.ActiveDirectoryEndpoint, test.wantAAD)
+		}
+	}
+}
+
+/* TestUnknownCloudFails verifies that an unknown cloud name is rejected */
+func TestUnknownCloudFails(t *testing.T) {
+	if _, err := newazuredns(testConfig("cloud = AzureMarsCloud\n")); err == nil {
+		t.Errorf("Expected an error for an unknown cloud")
+	}
+}
+
+/* TestManagedIdentityToken verifies that managed identity tokens are requested from the configured metadata endpoint */
+func TestManagedIdentityToken(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			t.Errorf("Missing Metadata header in token request")
+		}
+		if got := r.URL.Query().Get("resource"); got != azure.PublicCloud.ResourceManagerEndpoint {
+			t.Errorf("Token requested for resource %q", got)
+		}
+		if got := r.URL.Query().Get("client_id"); got != "identity" {
+			t.Errorf("Token requested for identity %q, expected %q", got, "identity")
+		}
+		fmt.Fprint(w, `{"access_token":"msi-token","expires_in":"3600","expires_on":"4102444800","resource":"r","token_type":"Bearer"}`)
+	}))
+	defer imds.Close()
+
+	var config Config
+	config.Global.UseManagedIdentity = true
+	config.Global.UserAssignedIdentityID = "identity"
+	config.Global.ManagedIdentityEndpoint = imds.URL
+
+	spt, err := newServicePrincipalToken(config, azure.PublicCloud.ResourceManagerEndpoint)
+	if err != nil {
+		t.Fatalf("Failed to create managed identity token: %v", err)
+	}
+	if err := spt.Refresh(); err != nil {
+		t.Fatalf("Failed to refresh managed identity token: %v", err)
+	}
+	if spt.OAuthToken() != "msi-token" {
+		t.Errorf("Got token %q, expected %q", spt.OAuthToken(), "msi-token")
+	}
+}
+
+/* TestManagedIdentityConfig verifies that managed identity does not require a service principal */
+func TestManagedIdentityConfig(t *testing.T) {
+	config := strings.NewReader("[Global]\nsubscription-id = sub\nresourceGroup = rg\nuse-managed-identity = true\nmanaged-identity-endpoint = http://127.0.0.1:1/token\n")
+	if _, err := newazuredns(config); err != nil {
+		t.Errorf("Unexpected error for managed identity config: %v", err)
+	}
+}
+
+/* TestCertificateToken verifies that a token can be built from a PKCS#12 client certificate */
+func TestCertificateToken(t *testing.T) {
+	var config Config
+	config.Global.TenantID = "tenant"
+	config.Global.ClientID = "client"
+	config.Global.ClientCertificatePath = "testdata/client.p12"
+	config.Global.ClientCertificatePassword = "password"
+
+	if _, err := newServicePrincipalToken(config, azure.PublicCloud.ResourceManagerEndpoint); err != nil {
+		t.Errorf("Failed to create certificate token: %v", err)
+	}
+
+	config.Global.ClientCertificatePassword = "wrong"
+	if _, err := newServicePrincipalToken(config, azure.PublicCloud.ResourceManagerEndpoint); err == nil {
+		t.Errorf("Expected an error for a wrong certificate password")
+	}
+}
+
+/* TestCredentialTypesExclusive verifies that exactly one credential type must be configured */
+func TestCredentialTypesExclusive(t *testing.T) {
+	if _, err := newazuredns(testConfig("client-certificate-path = testdata/client.p12\n")); err == nil {
+		t.Errorf("Expected an error for secret and certificate credentials")
+	}
+	if _, err := newazuredns(testConfig("use-managed-identity = true\n")); err == nil {
+		t.Errorf("Expected an error for secret and managed identity credentials")
+	}
+
+	config := strings.NewReader("[Global]\nsubscription-id = sub\ntenant-id = tenant\nclient-id = client\nresourceGroup = rg\nclient-certificate-path = testdata/client.p12\nclient-certificate-password = password\n")
+	if _, err := newazuredns(config); err != nil {
+		t.Errorf("Unexpected error for certificate credentials: %v", err)
+	}
+}
+
+// setEnv sets the environment variables and returns a function restoring the previous values
+func setEnv(vars map[string]string) func() {
+	previous := make(map[string]string)
+	for name, value := range vars {
+		previous[name] = os.Getenv(name)
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, value := range previous {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+/* TestLoadCredentialsPrecedence verifies that config, environment and credentials file are consulted in order */
+func TestLoadCredentialsPrecedence(t *testing.T) {
+	home, err := ioutil.TempDir("", "azuredns")
+	if err != nil {
+		t.Fatalf("Failed to create home directory: %v", err)
+	}
+	defer os.RemoveAll(home)
+
+	os.Mkdir(home+"/.azure", 0700)
+	credentials := `{"AZURE_SUBSCRIPTION_ID": "file-sub", "AZURE_TENANT_ID": "file-tenant", "AZURE_CLIENT_SECRET": "file-secret"}`
+	if err := ioutil.WriteFile(home+credentialsPath, []byte(credentials), 0600); err != nil {
+		t.Fatalf("Failed to write credentials file: %v", err)
+	}
+
+	defer setEnv(map[string]string{
+		"HOME":                  home,
+		"AZURE_SUBSCRIPTION_ID": "",
+		"AZURE_TENANT_ID":       "env-tenant",
+		"AZURE_CLIENT_ID":       "env-client",
+		"AZURE_CLIENT_SECRET":   "",
+		"AZURE_RESOURCE_GROUP":  "env-rg",
+	})()
+
+	var config Config
+	config.Global.ResourceGroup = "config-rg"
+	if err := loadCredentials(&config); err != nil {
+		t.Fatalf("Failed to load credentials: %v", err)
+	}
+
+	global := config.Global
+	if global.ResourceGroup != "config-rg" || global.TenantID != "env-tenant" || global.ClientID != "env-client" ||
+		global.SubscriptionID != "file-sub" || global.Secret != "file-secret" {
+		t.Errorf("Unexpected credentials %+v", global)
+	}
+}
+
+/* TestLoadCredentialsMissing verifies that the error lists every value missing from all sources */
+func TestLoadCredentialsMissing(t *testing.T) {
+	defer setEnv(map[string]string{
+		"HOME":                  "/nonexistent",
+		"AZURE_SUBSCRIPTION_ID": "",
+		"AZURE_TENANT_ID":       "",
+		"AZURE_CLIENT_ID":       "",
+		"AZURE_CLIENT_SECRET":   "",
+		"AZURE_RESOURCE_GROUP":  "",
+	})()
+
+	var config Config
+	config.Global.SubscriptionID = "sub"
+	config.Global.ClientCertificatePath = "testdata/client.p12"
+	err := loadCredentials(&config)
+	if err == nil {
+		t.Fatalf("Expected an error for missing credentials")
+	}
+	if !strings.Contains(err.Error(), "[AZURE_CLIENT_ID AZURE_RESOURCE_GROUP AZURE_TENANT_ID]") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+/* TestLoadCredentialsSubscriptionWide verifies that subscription-wide zones don't require a resource group */
+func TestLoadCredentialsSubscriptionWide(t *testing.T) {
+	defer setEnv(map[string]string{
+		"HOME":                 "/nonexistent",
+		"AZURE_RESOURCE_GROUP": "",
+	})()
+
+	var config Config
+	config.Global.SubscriptionID = "sub"
+	config.Global.TenantID = "tenant"
+	config.Global.ClientID = "client"
+	config.Global.Secret = "secret"
+	config.Global.SubscriptionWideZones = true
+	if err := loadCredentials(&config); err != nil {
+		t.Errorf("Unexpected error for subscription-wide zones: %v", err)
+	}
+
+	config.Global.SubscriptionWideZones = false
+	config.Subscription = map[string]*SubscriptionConfig{
+		"wide":   {SubscriptionID: "sub-1", SubscriptionWideZones: true},
+		"single": {SubscriptionID: "sub-2"},
+	}
+	if err := loadCredentials(&config); !errors.Is(err, ErrMissingCredentials) {
+		t.Errorf("Got %v, expected the resource group of subscription single to be required", err)
+	}
+}
+
+/* TestCloudProviderConfig verifies that the Kubernetes Azure cloud provider azure.json is accepted */
+func TestCloudProviderConfig(t *testing.T) {
+	config, err := readConfig(strings.NewReader(`
+	{
+		"cloud": "AzureChinaCloud",
+		"tenantId": "tenant",
+		"subscriptionId": "sub",
+		"aadClientId": "client",
+		"aadClientSecret": "secret",
+		"resourceGroup": "rg",
+		"location": "chinaeast"
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to read azure.json: %v", err)
+	}
+
+	global := config.Global
+	if global.Cloud != "AzureChinaCloud" || global.TenantID != "tenant" || global.SubscriptionID != "sub" ||
+		global.ClientID != "client" || global.Secret != "secret" || global.ResourceGroup != "rg" {
+		t.Errorf("Unexpected config %+v", global)
+	}
+
+	config, err = readConfig(strings.NewReader(`{"subscriptionId": "sub", "resourceGroup": "rg", "aadClientSecret": "unused", "useManagedIdentityExtension": true}`))
+	if err != nil {
+		t.Fatalf("Failed to read azure.json: %v", err)
+	}
+	if !config.Global.UseManagedIdentity || config.Global.Secret != "" {
+		t.Errorf("Expected managed identity without a secret, got %+v", config.Global)
+	}
+
+	if _, err := newazuredns(strings.NewReader(`{"subscriptionId": "sub", "resourceGroup": "rg", "useManagedIdentityExtension": true}`)); err != nil {
+		t.Errorf("Unexpected error for azure.json: %v", err)
+	}
+}
+
+/* TestConfigErrors verifies that configuration and authentication failures return typed errors */
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		want   error
+	}{
+		{"[Global]\nsubscription-id", ErrInvalidConfig},
+		{"[Global]\nsubscription-id = sub\nresourceGroup = rg\nsecret = s\nuse-managed-identity = true\n", ErrInvalidConfig},
+		{"[Global]\nsubscription-id = sub\ntenant-id = tenant\nclient-id = client\nsecret = secret\nresourceGroup = rg\ncloud = AzureMarsCloud\n", ErrInvalidCloud},
+		{"[Global]\nsubscription-id = sub\ntenant-id = bad%tenant\nclient-id = client\nsecret = secret\nresourceGroup = rg\n", ErrInvalidTenant},
+		{"[Global]\nsubscription-id = sub\ntenant-id = tenant\nclient-id = client\nresourceGroup = rg\nclient-certificate-path = testdata/missing.p12\n", ErrAuthFailed},
+	}
+
+	for _, test := range tests {
+		iface, err := dnsprovider.GetDnsProvider(ProviderName, strings.NewReader(test.config))
+		if !errors.Is(err, test.want) {
+			t.Errorf("Got error %v for config %q, expected %v", err, test.config, test.want)
+		}
+		if iface != nil {
+			t.Errorf("Got interface %v with error %v", iface, err)
+		}
+	}
+}
+
+/* TestWriteRateLimit verifies that ARM writes are spaced by the writes-per-second limit */
+func TestWriteRateLimit(t *testing.T) {
+	iface, closeAll := newARMTestInterface(t, "writes-per-second = 20\n", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	})
+	defer closeAll()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := iface.api.DeleteRecordSet("test.com", "www", dns.A, ""); err != nil {
+			t.Fatalf("Failed to delete record set: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("4 writes took %v, expected at least 150ms at 20 writes per second", elapsed)
+	}
+
+	if iface.api.readLimiter.Limit() != rate.Inf {
+		t.Errorf("Reads are limited to %v per second without a configured limit", iface.api.readLimiter.Limit())
+	}
+}
+
+/* TestListZonesPages verifies that all pages of zones are listed and writes go to each zone's resource group */
+func TestListZonesPages(t *testing.T) {
+	for _, subscriptionWide := range []bool{false, true} {
+		var paths []string
+		iface, closeAll := newARMTestInterface(t, fmt.Sprintf("subscription-wide-zones = %v\n", subscriptionWide), func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			switch {
+			case r.URL.Query().Get("page") == "2":
+				fmt.Fprint(w, `{"value": [{"id": "/subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.Network/dnszones/b.com", "name": "b.com"}]}`)
+			case strings.HasSuffix(r.URL.Path, "/dnszones") || strings.HasSuffix(r.URL.Path, "/dnsZones"):
+				fmt.Fprintf(w, `{"value": [{"id": "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/dnszones/a.com", "name": "a.com"}], "nextLink": "http://%s/next?page=2"}`, r.Host)
+			default:
+				fmt.Fprint(w, "{}")
+			}
+		})
+		defer closeAll()
+
+		zones, _ := iface.Zones()
+		list, err := zones.List()
+		if err != nil {
+			t.Fatalf("Failed to list zones: %v", err)
+		}
+		if len(list) != 2 || list[0].Name() != "a.com" || list[1].Name() != "b.com" {
+			t.Errorf("Got %d zones, expected a.com and b.com from both pages", len(list))
+		}
+
+		if strings.Contains(paths[0], "/resourceGroups/") == subscriptionWide {
+			t.Errorf("Listed zones with %s, expected subscription-wide = %v", paths[0], subscriptionWide)
+		}
+
+		if _, err := iface.service.DeleteRecordSet("b.com", "www", dns.A, ""); err != nil {
+			t.Fatalf("Failed to delete record set: %v", err)
+		}
+		if last := paths[len(paths)-1]; !strings.Contains(last, "/resourceGroups/other-rg/") {
+			t.Errorf("Deleted the record set with %s, expected the zone's resource group other-rg", last)
+		}
+	}
+}
+
+/* TestMultipleResourceGroups verifies that zones are listed from each resource group and record sets are routed to the zone's group */
+func TestMultipleResourceGroups(t *testing.T) {
+	var paths []string
+	iface, closeAll := newARMTestInterface(t, "resource-groups = rg2\nresource-groups = rg3\nresource-groups = rg\n", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		parts := strings.Split(r.URL.Path, "/")
+		if strings.HasSuffix(r.URL.Path, "/dnsZones") {
+			// every group has a zone of the same name
+			rg := parts[4]
+			fmt.Fprintf(w, `{"value": [{"id": "/subscriptions/sub/resourceGroups/%s/providers/Microsoft.Network/dnszones/shared.com", "name": "shared.com"}]}`, rg)
+			return
+		}
+		fmt.Fprint(w, `{"value": []}`)
+	})
+	defer closeAll()
+
+	zones, _ := iface.Zones()
+	list, err := zones.List()
+	if err != nil {
+		t.Fatalf("Failed to list zones: %v", err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("Got %d zones, expected one from each of rg, rg2 and rg3", len(list))
+	}
+
+	for i, expected := range []string{"rg", "rg2", "rg3"} {
+		zone := list[i].(*Zone)
+		if zone.ResourceGroup() != expected {
+			t.Errorf("Got resource group %q for zone %d, expected %q", zone.ResourceGroup(), i, expected)
+		}
+
+		rrsets, _ := zone.ResourceRecordSets()
+		if _, err := rrsets.List(); err != nil {
+			t.Fatalf("Failed to list record sets: %v", err)
+		}
+		if last := paths[len(paths)-1]; !strings.Contains(last, "/resourceGroups/"+expected+"/") {
+			t.Errorf("Listed the record sets with %s, expected resource group %s", last, expected)
+		}
+	}
+}
+
+/* TestZoneGroupsAmbiguous verifies that zones without a known resource group are routed by name only when unambiguous */
+func TestZoneGroupsAmbiguous(t *testing.T) {
+	var paths []string
+	iface, closeAll := newARMTestInterface(t, "resource-groups = rg2\nresource-groups = rg3\n", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		parts := strings.Split(r.URL.Path, "/")
+		if strings.HasSuffix(r.URL.Path, "/dnsZones") {
+			// shared.com is in rg2 and rg3, only2.com in rg2, neither in the default group
+			zone := `{"id": "/subscriptions/sub/resourceGroups/%s/providers/Microsoft.Network/dnszones/%s", "name": "%s"}`
+			switch rg := parts[4]; rg {
+			case "rg2":
+				fmt.Fprintf(w, `{"value": [`+zone+`, `+zone+`]}`, rg, "shared.com", "shared.com", rg, "only2.com", "only2.com")
+			case "rg3":
+				fmt.Fprintf(w, `{"value": [`+zone+`]}`, rg, "shared.com", "shared.com")
+			default:
+				fmt.Fprint(w, `{"value": []}`)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"value": []}`)
+	})
+	defer closeAll()
+
+	zones, _ := iface.Zones()
+	if _, err := zones.List(); err != nil {
+		t.Fatalf("Failed to list zones: %v", err)
+	}
+
+	only2, _ := zones.New("only2.com")
+	rrsets, _ := only2.ResourceRecordSets()
+	if _, err := rrsets.List(); err != nil {
+		t.Fatalf("Failed to list record sets: %v", err)
+	}
+	if last := paths[len(paths)-1]; !strings.Contains(last, "/resourceGroups/rg2/") {
+		t.Errorf("Listed the record sets with %s, expected resource group rg2", last)
+	}
+
+	requests := len(paths)
+	shared, _ := zones.New("shared.com")
+	rrsets, _ = shared.ResourceRecordSets()
+	if _, err := rrsets.List(); !errors.Is(err, ErrAmbiguousZone) {
+		t.Errorf("Got error %v, expected ErrAmbiguousZone", err)
+	}
+	if len(paths) != requests {
+		t.Errorf("Got requests %v for an ambiguous zone, expected none", paths[requests:])
+	}
+}
+
+/* TestMultipleSubscriptions verifies that zones are aggregated across subscription sections and each zone uses its own subscription */
+func TestMultipleSubscriptions(t *testing.T) {
+	var paths []string
+	settings := "[Subscription \"b\"]\nsubscription-id = sub-b\nresourceGroup = rg-b\nsecret = other-secret\n" +
+		"[Subscription \"a\"]\nsubscription-id = sub-a\n"
+	iface, closeAll := newARMTestInterface(t, settings, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		parts := strings.Split(r.URL.Path, "/")
+		if strings.HasSuffix(r.URL.Path, "/dnsZones") {
+			sub, rg := parts[2], parts[4]
+			fmt.Fprintf(w, `{"value": [{"id": "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnszones/%s.com", "name": "%s.com"}]}`, sub, rg, sub, sub)
+			return
+		}
+		fmt.Fprint(w, `{"value": []}`)
+	})
+	defer closeAll()
+	if iface.api.conf.Global.SubscriptionID != "sub-a" {
+		t.Errorf("Got default subscription %q, expected the first section sub-a", iface.api.conf.Global.SubscriptionID)
+	}
+
+	zones, _ := iface.Zones()
+	list, err := zones.List()
+	if err != nil {
+		t.Fatalf("Failed to list zones: %v", err)
+	}
+	if len(list) != 2 || list[0].Name() != "sub-a.com" || list[1].Name() != "sub-b.com" {
+		t.Fatalf("Got %d zones, expected one from each subscription", len(list))
+	}
+
+	for _, zone := range list {
+		rrsets, _ := zone.ResourceRecordSets()
+		if _, err := rrsets.List(); err != nil {
+			t.Fatalf("Failed to list record sets: %v", err)
+		}
+		expected := "/subscriptions/" + strings.TrimSuffix(zone.Name(), ".com") + "/"
+		if last := paths[len(paths)-1]; !strings.HasPrefix(last, expected) {
+			t.Errorf("Listed the record sets of %s with %s, expected subscription path %s", zone.Name(), last, expected)
+		}
+	}
+	if !strings.Contains(paths[len(paths)-1], "/resourceGroups/rg-b/") {
+		t.Errorf("Listed the record sets with %s, expected the section's resource group rg-b", paths[len(paths)-1])
+	}
+
+	// a new handle of a zone in another subscription is routed to it
+	zone, err := zones.New("sub-b.com")
+	if err != nil {
+		t.Fatalf("Failed to create zone handle: %v", err)
+	}
+	rrsets, _ := zone.ResourceRecordSets()
+	rrsets.List()
+	if last := paths[len(paths)-1]; !strings.HasPrefix(last, "/subscriptions/sub-b/resourceGroups/rg-b/") {
+		t.Errorf("Listed the record sets of the new handle with %s, expected subscription sub-b", last)
+	}
+
+	_, err = loadConfig(testConfig("[Subscription \"c\"]\nresourceGroup = rg-c\n"))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Got error %v for a section without subscription-id, expected ErrInvalidConfig", err)
+	}
+}
+
+/* TestGetRecordSetsByName verifies that Get looks up each record type of the name instead of listing the zone */
+func TestGetRecordSetsByName(t *testing.T) {
+	var paths []string
+	iface, closeAll := newARMTestInterface(t, "", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/dnsZones/test.com/A/www") {
+			fmt.Fprint(w, `{"id": "www", "name": "www", "type": "Microsoft.Network/dnszones/A", "properties": {"TTL": 180, "ARecords": [{"ipv4Address": "10.0.0.1"}]}}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": {"code": "NotFound"}}`)
+	})
+	defer closeAll()
+
+	zones, _ := iface.Zones()
+	zone, _ := zones.New("test.com")
+	rrsets, _ := zone.ResourceRecordSets()
+
+	list, err := rrsets.Get("www.test.com")
+	if err != nil {
+		t.Fatalf("Failed to get record sets: %v", err)
+	}
+	if len(list) != 1 || list[0].Type() != rrstype.A || list[0].Ttl() != 180 || list[0].Rrdatas()[0] != "10.0.0.1" {
+		t.Errorf("Got %v, expected the A record set of www", list)
+	}
+	if len(paths) != len(supportedRecordTypes) {
+		t.Errorf("Got requests %v, expected one per record type", paths)
+	}
+}
@@ -0,0 +1,401 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest"
+	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
+)
+
+// Compile time check for interface adherence
+var _ azurestub.API = &cacheAPI{}
+
+// cacheAPI decorates an API, caching the zones and record sets it reads for
+// the TTL. Successful writes invalidate the entries of the zone they modify.
+type cacheAPI struct {
+	api azurestub.API
+	ttl time.Duration
+	now func() time.Time
+	// resourceGroup resolves the resource group a request for a zone is sent to
+	resourceGroup func(ctx context.Context, zoneName string) string
+
+	lock sync.Mutex
+	// zones is the cached zone list, nil if not cached
+	zones *cacheEntry
+	// recordSets maps zone keys to the cached record sets of the zone
+	recordSets map[string]*cacheEntry
+	// names maps zone keys to the cached record sets by name and type
+	names map[string]map[recordSetKey]*cacheEntry
+
+	// zonesGeneration and generations count the invalidations of the zone
+	// list and of each zone key. A read only caches its result if no
+	// invalidation happened while it was in flight.
+	zonesGeneration uint64
+	generations     map[string]uint64
+}
+
+type cacheEntry struct {
+	expires time.Time
+	zones   dns.ZoneListResult
+	rrsets  []dns.RecordSet
+	// rrset is the record set of a name and type, nil if it doesn't exist
+	rrset *dns.RecordSet
+}
+
+type recordSetKey struct {
+	name       string
+	recordType dns.RecordType
+}
+
+// newCacheAPI caches the reads of api. resourceGroup resolves the resource
+// group of a zone like api does, if nil only the one in the context is used.
+func newCacheAPI(api azurestub.API, ttl time.Duration, resourceGroup func(ctx context.Context, zoneName string) string) *cacheAPI {
+	if resourceGroup == nil {
+		resourceGroup = func(ctx context.Context, zoneName string) string {
+			rg, _ := resourceGroupFromContext(ctx)
+			return rg
+		}
+	}
+	return &cacheAPI{
+		api:           api,
+		ttl:           ttl,
+		now:           time.Now,
+		resourceGroup: resourceGroup,
+		recordSets:    make(map[string]*cacheEntry),
+		names:         make(map[string]map[recordSetKey]*cacheEntry),
+		generations:   make(map[string]uint64),
+	}
+}
+
+// uncached returns the API decorated by api if it is a cacheAPI, api otherwise
+func uncached(api azurestub.API) azurestub.API {
+	if c, ok := api.(*cacheAPI); ok {
+		return c.api
+	}
+	return api
+}
+
+// zoneKey identifies a zone by name and the resource group it resolves to,
+// so that handles of the same zone share their entries
+func (c *cacheAPI) zoneKey(ctx context.Context, zoneName string) string {
+	return c.resourceGroup(ctx, zoneName) + "/" + zoneName
+}
+
+// fresh reports whether entry is cached and not expired
+func (c *cacheAPI) fresh(entry *cacheEntry) bool {
+	return entry != nil && c.now().Before(entry.expires)
+}
+
+func (c *cacheAPI) newEntry() *cacheEntry {
+	return &cacheEntry{expires: c.now().Add(c.ttl)}
+}
+
+// invalidateZone drops the cached record sets of a zone
+func (c *cacheAPI) invalidateZone(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.recordSets, key)
+	delete(c.names, key)
+	c.generations[key]++
+}
+
+// invalidateZones drops the cached zone list and the record sets of a zone
+func (c *cacheAPI) invalidateZones(key string) {
+	c.lock.Lock()
+	c.zones = nil
+	c.zonesGeneration++
+	c.lock.Unlock()
+	c.invalidateZone(key)
+}
+
+// run resyncs the cache every interval until stopCh is closed
+func (c *cacheAPI) run(interval time.Duration, stopCh <-chan struct{}) {
+	withFields("interval", interval).info(2, "Resyncing the DNS cache periodically")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := c.resync(context.Background()); err != nil {
+				logger{}.warning("Resyncing the DNS cache failed", fieldError, err)
+			}
+		}
+	}
+}
+
+// resync drops the cache and reads the zones and the record sets of each zone again
+func (c *cacheAPI) resync(ctx context.Context) error {
+	c.lock.Lock()
+	c.zones = nil
+	c.recordSets = make(map[string]*cacheEntry)
+	c.names = make(map[string]map[recordSetKey]*cacheEntry)
+	c.lock.Unlock()
+
+	zones, err := c.ListZonesWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, zone := range *zones.Value {
+		if zone.Name == nil {
+			continue
+		}
+		zoneCtx := ctx
+		if zone.ID != nil {
+			zoneCtx = withResourceGroup(ctx, resourceGroupFromID(*zone.ID))
+		}
+		if _, err := c.ListResourceRecordSetsByZoneWithContext(zoneCtx, *zone.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListZones lists the zones, from the cache if possible
+func (c *cacheAPI) ListZones() (dns.ZoneListResult, error) {
+	return c.ListZonesWithContext(context.Background())
+}
+
+// ListZonesWithContext lists the zones, from the cache if possible
+func (c *cacheAPI) ListZonesWithContext(ctx context.Context) (dns.ZoneListResult, error) {
+	c.lock.Lock()
+	entry := c.zones
+	generation := c.zonesGeneration
+	c.lock.Unlock()
+	if c.fresh(entry) {
+		zones := append([]dns.Zone(nil), *entry.zones.Value...)
+		return dns.ZoneListResult{Value: &zones}, nil
+	}
+
+	result, err := c.api.ListZonesWithContext(ctx)
+	if err != nil || result.Value == nil {
+		return result, err
+	}
+
+	entry = c.newEntry()
+	entry.zones = dns.ZoneListResult{Value: &[]dns.Zone{}}
+	*entry.zones.Value = append(*entry.zones.Value, *result.Value...)
+	c.lock.Lock()
+	if c.zonesGeneration == generation {
+		c.zones = entry
+	}
+	c.lock.Unlock()
+	return result, nil
+}
+
+// CreateOrUpdateZone creates or updates a zone and invalidates the cached zones
+func (c *cacheAPI) CreateOrUpdateZone(zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error) {
+	return c.CreateOrUpdateZoneWithContext(context.Background(), zoneName, zone, ifMatch, ifNoneMatch)
+}
+
+// CreateOrUpdateZoneWithContext creates or updates a zone and invalidates the cached zones
+func (c *cacheAPI) CreateOrUpdateZoneWithContext(ctx context.Context, zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error) {
+	result, err := c.api.CreateOrUpdateZoneWithContext(ctx, zoneName, zone, ifMatch, ifNoneMatch)
+	if err == nil {
+		c.invalidateZones(c.zoneKey(ctx, zoneName))
+	}
+	return result, err
+}
+
+// DeleteZone deletes a zone and invalidates the cached zones
+func (c *cacheAPI) DeleteZone(zoneName string, ifMatch string, cancel <-chan struct{}) (<-chan dns.ZoneDeleteResult, <-chan error) {
+	return deleteZoneAsync(cancel, func(ctx context.Context) (dns.ZoneDeleteResult, error) {
+		return c.DeleteZoneWithContext(ctx, zoneName, ifMatch)
+	})
+}
+
+// DeleteZoneWithContext deletes a zone and invalidates the cached zones
+func (c *cacheAPI) DeleteZoneWithContext(ctx context.Context, zoneName string, ifMatch string) (dns.ZoneDeleteResult, error) {
+	// resolve the key first, the API forgets the resource group of a deleted zone
+	key := c.zoneKey(ctx, zoneName)
+	result, err := c.api.DeleteZoneWithContext(ctx, zoneName, ifMatch)
+	if err == nil {
+		c.invalidateZones(key)
+	}
+	return result, err
+}
+
+// ListResourceRecordSetsByZone lists the record sets of a zone, from the cache if possible
+func (c *cacheAPI) ListResourceRecordSetsByZone(zoneName string) (*[]dns.RecordSet, error) {
+	return c.ListResourceRecordSetsByZoneWithContext(context.Background(), zoneName)
+}
+
+// ListResourceRecordSetsByZoneWithContext lists the record sets of a zone, from the cache if possible
+func (c *cacheAPI) ListResourceRecordSetsByZoneWithContext(ctx context.Context, zoneName string) (*[]dns.RecordSet, error) {
+	key := c.zoneKey(ctx, zoneName)
+
+	c.lock.Lock()
+	entry := c.recordSets[key]
+	generation := c.generations[key]
+	c.lock.Unlock()
+	if c.fresh(entry) {
+		rrsets := append([]dns.RecordSet(nil), entry.rrsets...)
+		return &rrsets, nil
+	}
+
+	result, err := c.api.ListResourceRecordSetsByZoneWithContext(ctx, zoneName)
+	if err != nil || result == nil {
+		return result, err
+	}
+
+	entry = c.newEntry()
+	entry.rrsets = append([]dns.RecordSet(nil), *result...)
+	c.lock.Lock()
+	if c.generations[key] == generation {
+		c.recordSets[key] = entry
+	}
+	c.lock.Unlock()
+	return result, nil
+}
+
+// CreateOrUpdateRecordSet creates or updates a record set and invalidates the cached record sets of the zone
+func (c *cacheAPI) CreateOrUpdateRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error) {
+	return c.CreateOrUpdateRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+}
+
+// CreateOrUpdateRecordSetWithContext creates or updates a record set and invalidates the cached record sets of the zone
+func (c *cacheAPI) CreateOrUpdateRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error) {
+	result, err := c.api.CreateOrUpdateRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+	if err == nil {
+		c.invalidateZone(c.zoneKey(ctx, zoneName))
+	}
+	return result, err
+}
+
+// DeleteRecordSet deletes a record set and invalidates the cached record sets of the zone
+func (c *cacheAPI) DeleteRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (autorest.Response, error) {
+	return c.DeleteRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType, ifMatch)
+}
+
+// DeleteRecordSetWithContext deletes a record set and invalidates the cached record sets of the zone
+func (c *cacheAPI) DeleteRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (autorest.Response, error) {
+	result, err := c.api.DeleteRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType, ifMatch)
+	if err == nil {
+		c.invalidateZone(c.zoneKey(ctx, zoneName))
+	}
+	return result, err
+}
+
+// GetRecordSet returns a record set, from the cache if possible
+func (c *cacheAPI) GetRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	return c.GetRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType)
+}
+
+// GetRecordSetWithContext returns a record set, from the cache if possible
+func (c *cacheAPI) GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	key := c.zoneKey(ctx, zoneName)
+	rsKey := recordSetKey{relativeRecordSetName, recordType}
+
+	c.lock.Lock()
+	entry := c.names[key][rsKey]
+	generation := c.generations[key]
+	c.lock.Unlock()
+	if c.fresh(entry) {
+		if entry.rrset == nil {
+			return dns.RecordSet{}, autorest.DetailedError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("record set %s of type %s not found in zone %s (cached)", relativeRecordSetName, recordType, zoneName),
+			}
+		}
+		return *entry.rrset, nil
+	}
+
+	result, err := c.api.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType)
+	switch {
+	case err == nil:
+		c.storeRecordSet(key, generation, rsKey, &result)
+	case isNotFound(err):
+		c.storeRecordSet(key, generation, rsKey, nil)
+	}
+	return result, err
+}
+
+// storeRecordSet caches the record set of a name and type, nil if it doesn't
+// exist, unless the zone was invalidated since generation was read
+func (c *cacheAPI) storeRecordSet(key string, generation uint64, rsKey recordSetKey, rrset *dns.RecordSet) {
+	entry := c.newEntry()
+	entry.rrset = rrset
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generations[key] != generation {
+		return
+	}
+	if c.names[key] == nil {
+		c.names[key] = make(map[recordSetKey]*cacheEntry)
+	}
+	c.names[key][rsKey] = entry
+}
+
+// ListRecordSetsByName returns the record sets of a name, from the cache if possible
+func (c *cacheAPI) ListRecordSetsByName(zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	return c.ListRecordSetsByNameWithContext(context.Background(), zoneName, relativeRecordSetName, recordTypes)
+}
+
+// ListRecordSetsByNameWithContext returns the record sets of a name, from the cache if possible.
+// Only the record types missing from the cache are requested.
+func (c *cacheAPI) ListRecordSetsByNameWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	key := c.zoneKey(ctx, zoneName)
+
+	rrsets := make([]dns.RecordSet, 0)
+	var missing []dns.RecordType
+
+	c.lock.Lock()
+	generation := c.generations[key]
+	for _, recordType := range recordTypes {
+		entry := c.names[key][recordSetKey{relativeRecordSetName, recordType}]
+		switch {
+		case !c.fresh(entry):
+			missing = append(missing, recordType)
+		case entry.rrset != nil:
+			rrsets = append(rrsets, *entry.rrset)
+		}
+	}
+	c.lock.Unlock()
+
+	if len(missing) == 0 {
+		return &rrsets, nil
+	}
+
+	result, err := c.api.ListRecordSetsByNameWithContext(ctx, zoneName, relativeRecordSetName, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[dns.RecordType]*dns.RecordSet)
+	for i := range *result {
+		rrset := (*result)[i]
+		if rrset.Type != nil {
+			found[recordTypeOf(*rrset.Type)] = &rrset
+		}
+		rrsets = append(rrsets, rrset)
+	}
+	for _, recordType := range missing {
+		c.storeRecordSet(key, generation, recordSetKey{relativeRecordSetName, recordType}, found[recordType])
+	}
+	return &rrsets, nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
+)
+
+// countingAPI wraps the mock API and counts the read calls
+type countingAPI struct {
+	azurestub.API
+	calls map[string]int
+	// afterList runs after the record sets of a zone are read, if set
+	afterList func()
+}
+
+func (c *countingAPI) ListZonesWithContext(ctx context.Context) (dns.ZoneListResult, error) {
+	c.calls["ListZones"]++
+	return c.API.ListZonesWithContext(ctx)
+}
+
+func (c *countingAPI) ListResourceRecordSetsByZoneWithContext(ctx context.Context, zoneName string) (*[]dns.RecordSet, error) {
+	c.calls["ListResourceRecordSetsByZone"]++
+	result, err := c.API.ListResourceRecordSetsByZoneWithContext(ctx, zoneName)
+	if c.afterList != nil {
+		c.afterList()
+	}
+	return result, err
+}
+
+func (c *countingAPI) GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	c.calls["GetRecordSet"]++
+	return c.API.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType)
+}
+
+func (c *countingAPI) ListRecordSetsByNameWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	c.calls["ListRecordSetsByName"] += len(recordTypes)
+	return c.API.ListRecordSetsByNameWithContext(ctx, zoneName, relativeRecordSetName, recordTypes)
+}
+
+// newTestCacheAPI returns a cache over a mock API holding the zone test.com,
+// the cache's clock is advanced by the returned function
+func newTestCacheAPI(t *testing.T) (*cacheAPI, *countingAPI, func(time.Duration)) {
+	api := &countingAPI{API: azurestub.NewAPIStub(), calls: make(map[string]int)}
+	if _, err := api.CreateOrUpdateZone("test.com", dns.Zone{Name: to.StringPtr("test.com")}, "", ""); err != nil {
+		t.Fatalf("Failed to create zone: %v", err)
+	}
+
+	now := time.Now()
+	c := newCacheAPI(api, time.Minute, nil)
+	c.now = func() time.Time { return now }
+	return c, api, func(d time.Duration) { now = now.Add(d) }
+}
+
+func testRecordSet(name string) dns.RecordSet {
+	return dns.RecordSet{
+		Name: to.StringPtr(name),
+		Type: to.StringPtr("A"),
+		Etag: to.StringPtr(""),
+		RecordSetProperties: &dns.RecordSetProperties{
+			TTL:      to.Int64Ptr(180),
+			ARecords: &[]dns.ARecord{{Ipv4Address: to.StringPtr("10.0.0.1")}},
+		},
+	}
+}
+
+/* TestCacheTTL verifies that reads are served from the cache until the TTL expires */
+func TestCacheTTL(t *testing.T) {
+	c, api, advance := newTestCacheAPI(t)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.ListZones(); err != nil {
+			t.Fatalf("Failed to list zones: %v", err)
+		}
+		if _, err := c.ListResourceRecordSetsByZone("test.com"); err != nil {
+			t.Fatalf("Failed to list record sets: %v", err)
+		}
+	}
+	if api.calls["ListZones"] != 1 || api.calls["ListResourceRecordSetsByZone"] != 1 {
+		t.Errorf("Got calls %v, expected one of each", api.calls)
+	}
+
+	advance(2 * time.Minute)
+	c.ListZones()
+	c.ListResourceRecordSetsByZone("test.com")
+	if api.calls["ListZones"] != 2 || api.calls["ListResourceRecordSetsByZone"] != 2 {
+		t.Errorf("Got calls %v after the TTL, expected two of each", api.calls)
+	}
+}
+
+/* TestCacheInvalidation verifies that writes invalidate the cached record sets of the zone */
+func TestCacheInvalidation(t *testing.T) {
+	c, api, _ := newTestCacheAPI(t)
+
+	rrsets, _ := c.ListRecordSetsByName("test.com", "www", supportedRecordTypes)
+	if len(*rrsets) != 0 {
+		t.Fatalf("Got %d record sets, expected none", len(*rrsets))
+	}
+	c.ListRecordSetsByName("test.com", "www", supportedRecordTypes)
+	c.ListResourceRecordSetsByZone("test.com")
+	if api.calls["ListRecordSetsByName"] != len(supportedRecordTypes) {
+		t.Errorf("Got %d lookups, expected the missing record sets to be cached", api.calls["ListRecordSetsByName"])
+	}
+
+	if _, err := c.CreateOrUpdateRecordSet("test.com", "www", dns.A, testRecordSet("www"), "", ""); err != nil {
+		t.Fatalf("Failed to create record set: %v", err)
+	}
+
+	rrsets, _ = c.ListRecordSetsByName("test.com", "www", supportedRecordTypes)
+	if len(*rrsets) != 1 {
+		t.Errorf("Got %d record sets after the write, expected the new one", len(*rrsets))
+	}
+	list, _ := c.ListResourceRecordSetsByZone("test.com")
+	if len(*list) != 1 || api.calls["ListResourceRecordSetsByZone"] != 2 {
+		t.Errorf("Got %d record sets with %d listings, expected the write to invalidate the zone", len(*list), api.calls["ListResourceRecordSetsByZone"])
+	}
+}
+
+/* TestCacheMisses verifies that missing record sets are served from the cache as not found */
+func TestCacheMisses(t *testing.T) {
+	c, api, _ := newTestCacheAPI(t)
+
+	c.ListRecordSetsByName("test.com", "www", supportedRecordTypes)
+	if _, err := c.GetRecordSet("test.com", "www", dns.A); !isNotFound(err) {
+		t.Errorf("Got error %v for a cached miss, expected not found", err)
+	}
+	if _, err := c.GetRecordSet("test.com", "api", dns.A); !isNotFound(err) {
+		t.Errorf("Got error %v, expected not found", err)
+	}
+	if _, err := c.GetRecordSet("test.com", "api", dns.A); !isNotFound(err) {
+		t.Errorf("Got error %v for a cached miss, expected not found", err)
+	}
+	if api.calls["GetRecordSet"] != 1 {
+		t.Errorf("Got %d lookups, expected only the first miss of api to be requested", api.calls["GetRecordSet"])
+	}
+
+	if _, err := c.CreateOrUpdateRecordSet("test.com", "www", dns.A, testRecordSet("www"), "", ""); err != nil {
+		t.Fatalf("Failed to create record set: %v", err)
+	}
+	if _, err := c.GetRecordSet("test.com", "www", dns.A); err != nil {
+		t.Errorf("Got error %v after the write, expected the new record set", err)
+	}
+}
+
+/* TestCacheResync verifies that a resync rereads the zones and their record sets */
+func TestCacheResync(t *testing.T) {
+	c, api, _ := newTestCacheAPI(t)
+
+	c.ListZones()
+	// bypass the cache to change the zone
+	api.CreateOrUpdateRecordSet("test.com", "www", dns.A, testRecordSet("www"), "", "")
+
+	if err := c.resync(context.Background()); err != nil {
+		t.Fatalf("Failed to resync: %v", err)
+	}
+	if api.calls["ListZones"] != 2 || api.calls["ListResourceRecordSetsByZone"] != 1 {
+		t.Errorf("Got calls %v, expected the resync to list the zones and their record sets", api.calls)
+	}
+
+	list, _ := c.ListResourceRecordSetsByZone("test.com")
+	if len(*list) != 1 || api.calls["ListResourceRecordSetsByZone"] != 1 {
+		t.Errorf("Got %d record sets, expected the resynced record set from the cache", len(*list))
+	}
+}
+
+/* TestCacheZoneKey verifies that handles of a zone with and without a resource group share their entries */
+func TestCacheZoneKey(t *testing.T) {
+	c, api, _ := newTestCacheAPI(t)
+	c.resourceGroup = func(ctx context.Context, zoneName string) string {
+		if rg, ok := resourceGroupFromContext(ctx); ok {
+			return rg
+		}
+		return "rg"
+	}
+	listed := withResourceGroup(context.Background(), "rg")
+
+	c.ListResourceRecordSetsByZoneWithContext(listed, "test.com")
+	if _, err := c.CreateOrUpdateRecordSet("test.com", "www", dns.A, testRecordSet("www"), "", ""); err != nil {
+		t.Fatalf("Failed to create record set: %v", err)
+	}
+	list, _ := c.ListResourceRecordSetsByZoneWithContext(listed, "test.com")
+	if len(*list) != 1 || api.calls["ListResourceRecordSetsByZone"] != 2 {
+		t.Errorf("Got %d record sets, expected the write to invalidate the zone in its resource group", len(*list))
+	}
+}
+
+/* TestCacheConcurrentInvalidation verifies that a read doesn't cache a result a concurrent write invalidated */
+func TestCacheConcurrentInvalidation(t *testing.T) {
+	c, api, _ := newTestCacheAPI(t)
+
+	api.afterList = func() {
+		api.afterList = nil
+		if _, err := c.CreateOrUpdateRecordSet("test.com", "www", dns.A, testRecordSet("www"), "", ""); err != nil {
+			t.Fatalf("Failed to create record set: %v", err)
+		}
+	}
+	if list, _ := c.ListResourceRecordSetsByZone("test.com"); len(*list) != 0 {
+		t.Fatalf("Got %d record sets, expected the read before the write", len(*list))
+	}
+
+	list, _ := c.ListResourceRecordSetsByZone("test.com")
+	if len(*list) != 1 || api.calls["ListResourceRecordSetsByZone"] != 2 {
+		t.Errorf("Got %d record sets, expected the stale read not to be cached", len(*list))
+	}
+}
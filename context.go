@@ -0,0 +1,77 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+)
+
+type resourceGroupKey struct{}
+
+// withResourceGroup routes the requests made with the returned context to the
+// resource group rg, overriding the group recorded for the zone
+func withResourceGroup(ctx context.Context, rg string) context.Context {
+	if rg == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, resourceGroupKey{}, rg)
+}
+
+// resourceGroupFromContext returns the resource group set by withResourceGroup
+func resourceGroupFromContext(ctx context.Context) (string, bool) {
+	rg, ok := ctx.Value(resourceGroupKey{}).(string)
+	return rg, ok
+}
+
+// cancelContext returns a context that is cancelled when cancel is closed.
+// The returned cancel function must be called to release the context.
+func cancelContext(cancel <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	if cancel != nil {
+		go func() {
+			select {
+			case <-cancel:
+				cancelFunc()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancelFunc
+}
+
+// deleteZoneAsync runs a context-aware zone deletion in the background and
+// delivers its outcome over channels like the SDK's ZonesClient.Delete.
+// The deletion is cancelled when cancel is closed.
+func deleteZoneAsync(cancel <-chan struct{}, deleteZone func(ctx context.Context) (dns.ZoneDeleteResult, error)) (<-chan dns.ZoneDeleteResult, <-chan error) {
+	resultChan := make(chan dns.ZoneDeleteResult, 1)
+	errChan := make(chan error, 1)
+
+	go func() {
+		ctx, cancelFunc := cancelContext(cancel)
+		defer cancelFunc()
+
+		result, err := deleteZone(ctx)
+		resultChan <- result
+		errChan <- err
+		close(resultChan)
+		close(errChan)
+	}()
+
+	return resultChan, errChan
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// newHangingInterface returns an interface with the default retry policy
+// whose ARM endpoint doesn't answer until the returned function is called
+func newHangingInterface(t *testing.T, settings string) (*Interface, func()) {
+	release := make(chan struct{})
+	iface, closeAll := newARMTestInterface(t, settings, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	return iface, func() {
+		close(release)
+		closeAll()
+	}
+}
+
+/* TestRequestTimeout verifies that calls without a deadline are bounded by the request-timeout across retries */
+func TestRequestTimeout(t *testing.T) {
+	iface, closeServers := newHangingInterface(t, "request-timeout = 100ms\n")
+	defer closeServers()
+
+	start := time.Now()
+	if _, err := iface.service.ListZones(); err == nil {
+		t.Errorf("Expected the request to time out")
+	}
+	// retrying five times with backoff would take over 15s
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("The request returned after %v, expected the 100ms timeout", elapsed)
+	}
+
+	zones, _ := iface.Zones()
+	if err := zones.Remove(&Zone{impl: &dns.Zone{Name: to.StringPtr("test.com")}, zones: &Zones{iface}}); err == nil {
+		t.Errorf("Expected the zone deletion to time out")
+	}
+}
+
+/* TestRequestCancel verifies that cancelling the context aborts requests and retries */
+func TestRequestCancel(t *testing.T) {
+	iface, closeServers := newHangingInterface(t, "")
+	defer closeServers()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := iface.service.DeleteZoneWithContext(ctx, "test.com", ""); err == nil {
+		t.Errorf("Expected the cancelled deletion to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("The deletion returned after %v, expected the cancellation after 100ms", elapsed)
+	}
+
+	r, api, delays := newTestRetryAPI(httpError(503, ""), httpError(503, ""))
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.ListZonesWithContext(ctx); err == nil {
+		t.Errorf("Expected an error for the cancelled context")
+	}
+	if api.calls != 1 || len(*delays) != 0 {
+		t.Errorf("Got %d calls and delays %v, expected no retries after cancellation", api.calls, *delays)
+	}
+}
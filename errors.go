@@ -0,0 +1,51 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import "errors"
+
+// Errors returned by New and the DNS provider factory.
+// The returned errors wrap one of these; test for them with errors.Is.
+var (
+	// ErrInvalidConfig is returned for an unreadable or inconsistent dns-provider-config
+	ErrInvalidConfig = errors.New("azuredns: invalid dns-provider-config")
+
+	// ErrMissingCredentials is returned when required values are missing from every config source
+	ErrMissingCredentials = errors.New("azuredns: missing credentials")
+
+	// ErrInvalidCloud is returned for an unknown Azure cloud environment
+	ErrInvalidCloud = errors.New("azuredns: unknown Azure cloud")
+
+	// ErrInvalidTenant is returned when no OAuth endpoint can be built for the AAD tenant
+	ErrInvalidTenant = errors.New("azuredns: invalid AAD tenant")
+
+	// ErrAuthFailed is returned when no token can be created from the configured credentials
+	ErrAuthFailed = errors.New("azuredns: authentication failed")
+)
+
+// ErrParentZoneNotFound is returned by Zones.AddDelegated when no managed zone
+// can delegate to the added zone
+var ErrParentZoneNotFound = errors.New("azuredns: no managed parent zone")
+
+// ErrAmbiguousZone is returned for requests through a zone handle that
+// doesn't know its resource group, e.g. from Zones.New, when zones of that
+// name were listed in several resource groups other than the configured one
+var ErrAmbiguousZone = errors.New("azuredns: zone exists in several resource groups")
+
+// ErrInvalidRecord is returned by ResourceRecordChangeset.Apply for record sets
+// whose rrdatas cannot be converted to Azure DNS records
+var ErrInvalidRecord = errors.New("azuredns: invalid rrdata")
@@ -17,14 +17,30 @@ limitations under the License.
 package azuredns
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
+	"golang.org/x/crypto/pkcs12"
 )
 
 const (
 	credentialsPath = "/.azure/credentials.json"
+
+	// Environment variables consulted for values missing from the dns-provider-config.
+	// The credentials file uses the same names as keys.
+	subscriptionIDEnvVar = "AZURE_SUBSCRIPTION_ID"
+	tenantIDEnvVar       = "AZURE_TENANT_ID"
+	clientIDEnvVar       = "AZURE_CLIENT_ID"
+	clientSecretEnvVar   = "AZURE_CLIENT_SECRET"
+	resourceGroupEnvVar  = "AZURE_RESOURCE_GROUP"
 )
 
 // ToJSON returns the passed item as a pretty-printed JSON string. If any JSON error occurs,
@@ -34,15 +50,231 @@ func ToJSON(v interface{}) (string, error) {
 	return string(j), err
 }
 
+// newServicePrincipalToken creates the token for the authentication mode selected in the config
+func newServicePrincipalToken(config Config, scope string) (*adal.ServicePrincipalToken, error) {
+	switch {
+	case config.Global.UseManagedIdentity:
+		return NewServicePrincipalTokenFromManagedIdentity(config, scope)
+	case config.Global.ClientCertificatePath != "":
+		return NewServicePrincipalTokenFromCertificate(config, scope)
+	default:
+		return NewServicePrincipalTokenFromCredentials(config, scope)
+	}
+}
+
+// NewServicePrincipalTokenFromManagedIdentity creates a new ServicePrincipalToken for the
+// managed identity of the host, obtained from the instance metadata service.
+// A user assigned identity is used if its client ID is configured.
+func NewServicePrincipalTokenFromManagedIdentity(config Config, scope string) (*adal.ServicePrincipalToken, error) {
+	endpoint := config.Global.ManagedIdentityEndpoint
+	if endpoint == "" {
+		var err error
+		if endpoint, err = adal.GetMSIVMEndpoint(); err != nil {
+			return authResult(nil, err)
+		}
+	}
+
+	if config.Global.UserAssignedIdentityID != "" {
+		return authResult(adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, scope, config.Global.UserAssignedIdentityID))
+	}
+	return authResult(adal.NewServicePrincipalTokenFromMSI(endpoint, scope))
+}
+
+// loadCredentials fills in the values the dns-provider-config omits.
+// Each value is taken from the first of these sources that sets it:
+//  1. the dns-provider-config
+//  2. the AZURE_* environment variables
+//  3. $HOME/.azure/credentials.json, a JSON object keyed by the environment variable names
+//
+// Only the values needed by the configured authentication mode are loaded.
+// The returned error lists the values that are missing from every source.
+func loadCredentials(config *Config) error {
+	values := credentialValues(config)
+
+	for name, value := range values {
+		if *value == "" {
+			*value = os.Getenv(name)
+		}
+	}
+	if checkEnvVar(requiredValues(config, values)) == nil {
+		return nil
+	}
+
+	path := os.Getenv("HOME") + credentialsPath
+	credentials, err := readCredentialsFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%w: reading credentials file %q: %v", ErrInvalidConfig, path, err)
+	}
+	for name, value := range values {
+		if *value == "" {
+			*value = credentials[name]
+		}
+	}
+
+	return checkEnvVar(requiredValues(config, values))
+}
+
+// credentialValues maps the environment variable names to the config values required
+// by the configured authentication mode
+func credentialValues(config *Config) map[string]*string {
+	global := &config.Global
+	values := map[string]*string{
+		subscriptionIDEnvVar: &global.SubscriptionID,
+		resourceGroupEnvVar:  &global.ResourceGroup,
+	}
+
+	if !global.UseManagedIdentity {
+		values[tenantIDEnvVar] = &global.TenantID
+		values[clientIDEnvVar] = &global.ClientID
+		if global.ClientCertificatePath == "" {
+			values[clientSecretEnvVar] = &global.Secret
+		}
+	}
+	return values
+}
+
+// requiredValues returns the current values that must be set. The resource
+// group is loaded when available but only required if a managed subscription
+// falls back to it.
+func requiredValues(config *Config, values map[string]*string) *map[string]string {
+	current := make(map[string]string, len(values))
+	for name, value := range values {
+		current[name] = *value
+	}
+	if !config.requiresResourceGroup() {
+		delete(current, resourceGroupEnvVar)
+	}
+	return &current
+}
+
+func readCredentialsFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials map[string]string
+	if err := json.Unmarshal(b, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
 // NewServicePrincipalTokenFromCredentials creates a new ServicePrincipalToken using values of the
 // passed credentials map.
 // This implementation is "borrowed" from a later version of the azuresdk-for-go/arm/examples
 func NewServicePrincipalTokenFromCredentials(config Config, scope string) (*adal.ServicePrincipalToken, error) {
+	oauthConfig, err := newOAuthConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return authResult(adal.NewServicePrincipalToken(*oauthConfig, config.Global.ClientID, config.Global.Secret, scope))
+}
 
-	oauthConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, config.Global.TenantID)
+// NewServicePrincipalTokenFromCertificate creates a new ServicePrincipalToken using the
+// PKCS#12 client certificate and password from the config.
+func NewServicePrincipalTokenFromCertificate(config Config, scope string) (*adal.ServicePrincipalToken, error) {
+	oauthConfig, err := newOAuthConfig(config)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return adal.NewServicePrincipalToken(*oauthConfig, config.Global.ClientID, config.Global.Secret, scope)
+	certificate, privateKey, err := decodePkcs12File(config.Global.ClientCertificatePath, config.Global.ClientCertificatePassword)
+	if err != nil {
+		return authResult(nil, err)
+	}
+
+	return authResult(adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, config.Global.ClientID, certificate, privateKey, scope))
+}
+
+// newOAuthConfig returns the OAuth endpoints of the configured tenant
+func newOAuthConfig(config Config) (*adal.OAuthConfig, error) {
+	env, err := azureEnvironment(config)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, config.Global.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidTenant, config.Global.TenantID, err)
+	}
+	return oauthConfig, nil
+}
+
+// authResult wraps token creation failures in ErrAuthFailed
+func authResult(spt *adal.ServicePrincipalToken, err error) (*adal.ServicePrincipalToken, error) {
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	return spt, nil
+}
+
+// decodePkcs12File reads the certificate and RSA private key from a PKCS#12 file
+func decodePkcs12File(path string, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading client certificate %q: %v", path, err)
+	}
+
+	privateKey, certificate, err := pkcs12.Decode(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding client certificate %q: %v", path, err)
+	}
+
+	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("client certificate %q does not contain an RSA private key", path)
+	}
+	return certificate, rsaPrivateKey, nil
+}
+
+// durationOrDefault parses a duration from the config, def is returned
+// for empty or invalid values
+func durationOrDefault(value string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// resourceGroupFromID returns the resource group of an ARM resource ID like
+// /subscriptions/{id}/resourceGroups/{group}/providers/Microsoft.Network/dnszones/{zone}
+// or the empty string if the ID doesn't contain one
+func resourceGroupFromID(id string) string {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "resourceGroups") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// azureEnvironment returns the Azure environment named by the cloud (or environment)
+// setting with any explicit endpoint overrides applied.
+// Defaults to the Azure public cloud.
+func azureEnvironment(config Config) (azure.Environment, error) {
+	env := azure.PublicCloud
+
+	name := config.Global.Cloud
+	if name == "" {
+		name = config.Global.Environment
+	}
+	if name != "" {
+		var err error
+		env, err = azure.EnvironmentFromName(name)
+		if err != nil {
+			return env, fmt.Errorf("%w %q: %v", ErrInvalidCloud, name, err)
+		}
+	}
+
+	if config.Global.ResourceManagerEndpoint != "" {
+		env.ResourceManagerEndpoint = config.Global.ResourceManagerEndpoint
+	}
+	if config.Global.ActiveDirectoryEndpoint != "" {
+		env.ActiveDirectoryEndpoint = config.Global.ActiveDirectoryEndpoint
+	}
+	return env, nil
 }
@@ -0,0 +1,70 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testConfig returns a dns-provider-config with valid service principal
+// credentials followed by the given extra [Global] settings
+func testConfig(extra string) *strings.Reader {
+	return strings.NewReader("[Global]\nsubscription-id = sub\ntenant-id = tenant\nclient-id = client\nsecret = secret\nresourceGroup = rg\n" + extra)
+}
+
+// newFakeAAD returns a token endpoint issuing tokens named after the client secret
+func newFakeAAD() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"access_token":"token-%s","expires_in":"3600","expires_on":"4102444800","resource":"r","token_type":"Bearer"}`, r.PostFormValue("client_secret"))
+	}))
+}
+
+// newARMTestInterface returns an Interface created by New from testConfig and
+// settings, which may add subscription sections. Its ARM requests are
+// answered by arm, 404 if nil, and its tokens are issued by newFakeAAD.
+// The returned function closes the interface and the servers.
+func newARMTestInterface(t *testing.T, settings string, arm http.HandlerFunc) (*Interface, func()) {
+	if arm == nil {
+		arm = http.NotFound
+	}
+	aad := newFakeAAD()
+	armServer := httptest.NewServer(arm)
+	closeServers := func() {
+		armServer.Close()
+		aad.Close()
+	}
+
+	config, err := loadConfig(testConfig("resource-manager-endpoint = " + armServer.URL + "/\nactive-directory-endpoint = " + aad.URL + "/\n" + settings))
+	if err != nil {
+		closeServers()
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	iface, err := New(config)
+	if err != nil {
+		closeServers()
+		t.Fatalf("Failed to create interface: %v", err)
+	}
+
+	return iface, func() {
+		iface.Close()
+		closeServers()
+	}
+}
@@ -17,13 +17,21 @@ limitations under the License.
 package azuredns
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
 	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
-	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
 	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
 )
@@ -33,17 +41,142 @@ import (
 // The interface is defined in stubs/azurednsapi.go
 
 // Compile time check for interface adherence
-var _ dnsprovider.Interface = Interface{}
+var _ dnsprovider.Interface = &Interface{}
 
 // Interface is the abstraction layer to allow for mocking
 type Interface struct {
+	// service is the API of the default subscription, new zones are added to it
 	service azurestub.API
+	// api is the DNSAPI behind service, nil when service is a mock
+	api *DNSAPI
+
+	// subscriptions holds every managed subscription when the config has
+	// subscription sections, the default one first
+	subscriptions []subscription
+
+	// metrics and tracing are shared by the DNSAPIs of all subscriptions, nil for mocks
+	metrics *metrics
+	tracing *tracing
+	// audit records the mutations made through the Zones of the interface
+	audit *auditing
+	// auditFile is the audit sink New opened from the config, nil if none
+	auditFile *FileAuditSink
+
+	// background runs the credential watchers and cache resyncs until Close
+	background *background
+}
+
+// background tracks the goroutines started by New, a nil *background
+// starts nothing
+type background struct {
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newBackground() *background {
+	return &background{stopCh: make(chan struct{})}
+}
+
+// goUntilStopped runs fn in a goroutine, fn must return once its stop channel is closed
+func (b *background) goUntilStopped(fn func(stopCh <-chan struct{})) {
+	if b == nil {
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.stopCh)
+	}()
+}
+
+// stop closes the stop channel and waits for the goroutines to return
+func (b *background) stop() {
+	if b == nil {
+		return
+	}
+	b.stopOnce.Do(func() { close(b.stopCh) })
+	b.wg.Wait()
+}
+
+// subscription is the API of one managed Azure subscription
+type subscription struct {
+	name    string
+	service azurestub.API
+	api     *DNSAPI
+}
+
+// services returns the APIs of all managed subscriptions
+func (c *Interface) services() []subscription {
+	if len(c.subscriptions) == 0 {
+		return []subscription{{service: c.service, api: c.api}}
+	}
+	return c.subscriptions
 }
 
 // Zones initializes a new Zones interface, which is the root
 // of the DNS hierarchy
-func (c Interface) Zones() (dnsprovider.Zones, bool) {
-	return Zones{&c}, true
+func (c *Interface) Zones() (dnsprovider.Zones, bool) {
+	return Zones{c}, true
+}
+
+// Close stops the credential watchers and cache resyncs of the interface and
+// closes the audit log opened from the config. It is safe to call more than once.
+func (c *Interface) Close() error {
+	c.background.stop()
+	if c.auditFile != nil {
+		return c.auditFile.Close()
+	}
+	return nil
+}
+
+// OnTokenRefreshError registers a function called whenever refreshing the
+// Azure access token fails
+func (c *Interface) OnTokenRefreshError(hook func(error)) {
+	for _, sub := range c.services() {
+		if sub.api != nil {
+			sub.api.OnTokenRefreshError(hook)
+		}
+	}
+}
+
+// RegisterMetrics registers the Prometheus metrics of the Azure DNS
+// requests and changesets with registerer
+func (c *Interface) RegisterMetrics(registerer prometheus.Registerer) error {
+	if c.metrics == nil {
+		return nil
+	}
+	return c.metrics.register(registerer)
+}
+
+// SetTracerProvider sets the OpenTelemetry tracer provider of the changeset
+// and request spans. The global provider is used by default.
+func (c *Interface) SetTracerProvider(provider trace.TracerProvider) {
+	if c.tracing == nil {
+		c.tracing = &tracing{}
+	}
+	c.tracing.setProvider(provider)
+}
+
+// SetAuditSink sets the sink recording every zone and record set mutation.
+// A nil sink disables auditing.
+func (c *Interface) SetAuditSink(sink AuditSink) {
+	if c.audit == nil {
+		c.audit = &auditing{}
+	}
+	c.audit.setSink(sink)
+}
+
+// auditEvent returns an event of a mutation of zone through svc
+func (c *Interface) auditEvent(svc azurestub.API, operation string, zone string) AuditEvent {
+	event := AuditEvent{Operation: operation, Zone: zone}
+	for _, sub := range c.services() {
+		if sub.service == svc && sub.api != nil {
+			event.Subscription = sub.api.conf.Global.SubscriptionID
+			event.Principal = sub.api.principal()
+		}
+	}
+	return event
 }
 
 // compile time check
@@ -55,103 +188,644 @@ type DNSAPI struct {
 	rc   dns.RecordSetsClient
 	zc   dns.ZonesClient
 	conf Config
+
+	// auth is shared by all clients and swapped when the credentials are reloaded
+	auth *reloadableAuthorizer
+
+	hookLock       sync.RWMutex
+	onRefreshError func(error)
+
+	// client side rate limits for ARM read and write requests
+	readLimiter  *rate.Limiter
+	writeLimiter *rate.Limiter
+
+	// timeout bounds each request whose context has no deadline. Behind
+	// retryAPI the context already carries the deadline of all attempts.
+	timeout time.Duration
+
+	// metrics records the requests, nil if not instrumented
+	metrics *metrics
+	tracing *tracing
+
+	// zoneGroups maps zone names to the resource groups they were listed in,
+	// a name can be listed in several groups
+	zoneLock   sync.RWMutex
+	zoneGroups map[string]map[string]bool
+}
+
+// defaultRequestTimeout bounds requests when the request-timeout isn't configured.
+// Zone deletion is a long running operation and includes the polling.
+const defaultRequestTimeout = 5 * time.Minute
+
+// newRateLimiter returns a limiter allowing perSecond requests per second,
+// evenly spaced. Zero or less means unlimited.
+func newRateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
+
+// waitForRead blocks until the read rate limit allows another request or ctx is done
+func (c *DNSAPI) waitForRead(ctx context.Context) error {
+	return c.readLimiter.Wait(ctx)
+}
+
+// waitForWrite blocks until the write rate limit allows another request or ctx is done
+func (c *DNSAPI) waitForWrite(ctx context.Context) error {
+	return c.writeLimiter.Wait(ctx)
+}
+
+// withTimeout bounds ctx by the configured request timeout unless it has a deadline already
+func (c *DNSAPI) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// send prepares a request, sends it bound to ctx and handles the response.
+// The SDK methods without a context are composed the same way.
+// The request is recorded in the metrics and in a span as call.
+func (c *DNSAPI) send(ctx context.Context, call apiCall, client string, method string,
+	prepare func() (*http.Request, error),
+	sender func(*http.Request) (*http.Response, error),
+	respond func(*http.Response) error) (err error) {
+	var resp *http.Response
+	ctx, span := c.startCall(ctx, call)
+	defer func(start time.Time) {
+		c.metrics.observeRequest(call, start, resp, err)
+		logRequest(call, start, resp, err)
+		setResponseAttributes(span, resp)
+		endSpan(span, call.failure(err))
+	}(time.Now())
+
+	req, err := prepare()
+	if err != nil {
+		return autorest.NewErrorWithError(err, client, method, nil, "Failure preparing request")
+	}
+
+	resp, err = sender(req.WithContext(ctx))
+	if err != nil {
+		return autorest.NewErrorWithError(err, client, method, resp, sendFailure)
+	}
+
+	if err := respond(resp); err != nil {
+		return autorest.NewErrorWithError(err, client, method, resp, "Failure responding to request")
+	}
+	return nil
 }
 
 // DeleteRecordSet deletes a DNS record
-func (c *DNSAPI) DeleteRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (result autorest.Response, err error) {
-	glog.V(4).Infof("azuredns: Deleting RecordSet %q type %q for zone %s in rg %q\n", relativeRecordSetName, string(recordType), zoneName, c.conf.Global.ResourceGroup)
+func (c *DNSAPI) DeleteRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (autorest.Response, error) {
+	return c.DeleteRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType, ifMatch)
+}
+
+// DeleteRecordSetWithContext deletes a DNS record, giving up when ctx is done
+func (c *DNSAPI) DeleteRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (result autorest.Response, err error) {
+	rg, err := c.resourceGroup(ctx, zoneName)
+	if err != nil {
+		return result, err
+	}
+	withFields(fieldZone, zoneName, fieldName, relativeRecordSetName, fieldType, string(recordType), fieldResourceGroup, rg).
+		info(4, "Deleting record set")
 
-	return c.rc.Delete(c.conf.Global.ResourceGroup, zoneName, relativeRecordSetName, recordType, ifMatch)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if err = c.waitForWrite(ctx); err != nil {
+		return result, err
+	}
+
+	err = c.send(ctx, apiCall{operation: "DeleteRecordSet", zone: zoneName, name: relativeRecordSetName, recordType: recordType}, "dns.RecordSetsClient", "Delete",
+		func() (*http.Request, error) {
+			return c.rc.DeletePreparer(rg, zoneName, relativeRecordSetName, recordType, ifMatch)
+		},
+		c.rc.DeleteSender,
+		func(resp *http.Response) error {
+			result, err = c.rc.DeleteResponder(resp)
+			return err
+		})
+	return result, err
 }
 
 // CreateOrUpdateRecordSet creates or updates a Record Set
 func (c *DNSAPI) CreateOrUpdateRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error) {
-	glog.V(4).Infof("azuredns: CreateOrUpdate RecordSets %q type %q for zone %q in rg %q\n", relativeRecordSetName, string(recordType), zoneName, c.conf.Global.ResourceGroup)
+	return c.CreateOrUpdateRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+}
+
+// CreateOrUpdateRecordSetWithContext creates or updates a Record Set, giving up when ctx is done
+func (c *DNSAPI) CreateOrUpdateRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (result dns.RecordSet, err error) {
+	rg, err := c.resourceGroup(ctx, zoneName)
+	if err != nil {
+		return result, err
+	}
+	withFields(fieldZone, zoneName, fieldName, relativeRecordSetName, fieldType, string(recordType), fieldResourceGroup, rg).
+		info(4, "Creating or updating record set")
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if err = c.waitForWrite(ctx); err != nil {
+		return result, err
+	}
+
+	err = c.send(ctx, apiCall{operation: "CreateOrUpdateRecordSet", zone: zoneName, name: relativeRecordSetName, recordType: recordType}, "dns.RecordSetsClient", "CreateOrUpdate",
+		func() (*http.Request, error) {
+			return c.rc.CreateOrUpdatePreparer(rg,
+				zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+		},
+		c.rc.CreateOrUpdateSender,
+		func(resp *http.Response) error {
+			result, err = c.rc.CreateOrUpdateResponder(resp)
+			return err
+		})
+	return result, err
+}
+
+// startCall opens the span of an ARM request
+func (c *DNSAPI) startCall(ctx context.Context, call apiCall) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attrZone.String(call.zone)}
+	if call.name != "" {
+		attrs = append(attrs, attrRecordName.String(call.name))
+	}
+	if call.recordType != "" {
+		attrs = append(attrs, attrRecordType.String(string(call.recordType)))
+	}
+	return c.tracing.start(ctx, "azuredns."+call.operation, attrs...)
+}
 
-	return c.rc.CreateOrUpdate(c.conf.Global.ResourceGroup,
-		zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+// GetRecordSet returns the record set of the name and type
+func (c *DNSAPI) GetRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	return c.GetRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType)
 }
 
-func (c *DNSAPI) appendListRecordSetsResult(rrsets *[]dns.RecordSet, result dns.RecordSetListResult) error {
-	for _, rset := range *result.Value {
-		*rrsets = append(*rrsets, rset)
+// GetRecordSetWithContext returns the record set of the name and type, giving up when ctx is done
+func (c *DNSAPI) GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (result dns.RecordSet, err error) {
+	rg, err := c.resourceGroup(ctx, zoneName)
+	if err != nil {
+		return result, err
 	}
+	withFields(fieldZone, zoneName, fieldName, relativeRecordSetName, fieldType, string(recordType), fieldResourceGroup, rg).
+		info(5, "Getting record set")
 
-	if result.NextLink != nil {
-		result, err := c.rc.ListByDNSZoneNextResults(result)
-		if err == nil {
-			c.appendListRecordSetsResult(rrsets, result)
-		} else {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if err = c.waitForRead(ctx); err != nil {
+		return result, err
+	}
+
+	err = c.send(ctx, apiCall{operation: "GetRecordSet", zone: zoneName, name: relativeRecordSetName, recordType: recordType, lookup: true}, "dns.RecordSetsClient", "Get",
+		func() (*http.Request, error) {
+			return c.rc.GetPreparer(rg, zoneName, relativeRecordSetName, recordType)
+		},
+		c.rc.GetSender,
+		func(resp *http.Response) error {
+			result, err = c.rc.GetResponder(resp)
 			return err
+		})
+	return result, err
+}
+
+// ListRecordSetsByName returns the existing record sets of the name with one of the types
+func (c *DNSAPI) ListRecordSetsByName(zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	return c.ListRecordSetsByNameWithContext(context.Background(), zoneName, relativeRecordSetName, recordTypes)
+}
+
+// ListRecordSetsByNameWithContext returns the existing record sets of the name with one
+// of the types, giving up when ctx is done. It requests each type once, the
+// record sets list of this API version can't be filtered by name.
+func (c *DNSAPI) ListRecordSetsByNameWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	rrsets := make([]dns.RecordSet, 0)
+	for _, recordType := range recordTypes {
+		rset, err := c.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType)
+		if isNotFound(err) {
+			continue
 		}
+		if err != nil {
+			return nil, err
+		}
+		rrsets = append(rrsets, rset)
 	}
-	return nil
+	return &rrsets, nil
+}
+
+// listRecordSets requests one page of record sets, prepare returns a nil
+// request after the last page
+func (c *DNSAPI) listRecordSets(ctx context.Context, zoneName string, prepare func() (*http.Request, error)) (result dns.RecordSetListResult, err error) {
+	if err = c.waitForRead(ctx); err != nil {
+		return result, err
+	}
+
+	err = c.send(ctx, apiCall{operation: "ListResourceRecordSetsByZone", zone: zoneName}, "dns.RecordSetsClient", "ListByDNSZone",
+		prepare,
+		c.rc.ListByDNSZoneSender,
+		func(resp *http.Response) error {
+			result, err = c.rc.ListByDNSZoneResponder(resp)
+			return err
+		})
+	return result, err
 }
 
 // ListResourceRecordSetsByZone lists all record sets for a zone
 func (c *DNSAPI) ListResourceRecordSetsByZone(zoneName string) (*[]dns.RecordSet, error) {
-	glog.V(5).Infof("azuredns: Listing RecordSets for zone %s in rg %s\n", zoneName, c.conf.Global.ResourceGroup)
+	return c.ListResourceRecordSetsByZoneWithContext(context.Background(), zoneName)
+}
 
-	rrsets := make([]dns.RecordSet, 0)
+// ListResourceRecordSetsByZoneWithContext lists all record sets for a zone, giving up when ctx is done
+func (c *DNSAPI) ListResourceRecordSetsByZoneWithContext(ctx context.Context, zoneName string) (*[]dns.RecordSet, error) {
+	rg, err := c.resourceGroup(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+	withFields(fieldZone, zoneName, fieldResourceGroup, rg).info(5, "Listing record sets")
 
-	result, err := c.rc.ListByDNSZone(c.conf.Global.ResourceGroup,
-		zoneName,
-		to.Int32Ptr(1000))
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
-	err = c.appendListRecordSetsResult(&rrsets, result)
+	rrsets := make([]dns.RecordSet, 0)
 
-	if err != nil {
-		return nil, err
+	result, err := c.listRecordSets(ctx, zoneName, func() (*http.Request, error) {
+		return c.rc.ListByDNSZonePreparer(rg, zoneName, to.Int32Ptr(1000))
+	})
+	for err == nil {
+		if result.Value != nil {
+			rrsets = append(rrsets, *result.Value...)
+		}
+		if result.NextLink == nil || *result.NextLink == "" {
+			c.metrics.setZoneRecordSets(zoneName, len(rrsets))
+			return &rrsets, nil
+		}
+		result, err = c.listRecordSets(ctx, zoneName, result.RecordSetListResultPreparer)
 	}
-	return &rrsets, nil
+	return nil, err
 }
 
-// ListZones lists the zones in the configured resource group
+// ListZones lists the zones in the configured resource groups, or in the
+// whole subscription if subscription-wide-zones is set
 func (c *DNSAPI) ListZones() (dns.ZoneListResult, error) {
-	glog.V(5).Infof("azuredns: Requesting DNS zones")
-	// request all 100 zones. 100 is the current limit per subscription
-	return c.zc.List(to.Int32Ptr(100))
+	return c.ListZonesWithContext(context.Background())
+}
+
+// ListZonesWithContext lists the zones like ListZones, giving up when ctx is done.
+// All pages are returned in a single result.
+func (c *DNSAPI) ListZonesWithContext(ctx context.Context) (dns.ZoneListResult, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	zones := make([]dns.Zone, 0)
+	if c.conf.Global.SubscriptionWideZones {
+		withFields(fieldSubscription, c.conf.Global.SubscriptionID).info(5, "Listing zones")
+		err := c.listAllZones(ctx, &zones, "List", func() (*http.Request, error) {
+			return c.zc.ListPreparer(to.Int32Ptr(100))
+		})
+		if err != nil {
+			return dns.ZoneListResult{}, err
+		}
+	} else {
+		for _, rg := range c.conf.resourceGroups() {
+			withFields(fieldResourceGroup, rg).info(5, "Listing zones")
+			rg := rg
+			err := c.listAllZones(ctx, &zones, "ListByResourceGroup", func() (*http.Request, error) {
+				return c.zc.ListByResourceGroupPreparer(rg, to.Int32Ptr(100))
+			})
+			if err != nil {
+				return dns.ZoneListResult{}, err
+			}
+		}
+	}
+
+	c.recordResourceGroups(zones)
+	return dns.ZoneListResult{Value: &zones}, nil
+}
+
+// listAllZones appends the zones from all pages of a list operation
+func (c *DNSAPI) listAllZones(ctx context.Context, zones *[]dns.Zone, method string, prepare func() (*http.Request, error)) error {
+	result, err := c.listZones(ctx, method, prepare)
+	for err == nil {
+		if result.Value != nil {
+			*zones = append(*zones, *result.Value...)
+		}
+		if result.NextLink == nil || *result.NextLink == "" {
+			return nil
+		}
+		result, err = c.listZones(ctx, method, result.ZoneListResultPreparer)
+	}
+	return err
+}
+
+// listZones requests one page of zones
+func (c *DNSAPI) listZones(ctx context.Context, method string, prepare func() (*http.Request, error)) (result dns.ZoneListResult, err error) {
+	if err = c.waitForRead(ctx); err != nil {
+		return result, err
+	}
+
+	// both list operations share the response format
+	err = c.send(ctx, apiCall{operation: "ListZones"}, "dns.ZonesClient", method,
+		prepare,
+		c.zc.ListSender,
+		func(resp *http.Response) error {
+			result, err = c.zc.ListResponder(resp)
+			return err
+		})
+	return result, err
+}
+
+// recordResourceGroups remembers the resource group of each zone from its ARM ID,
+// subsequent requests for the zone are sent to that group
+func (c *DNSAPI) recordResourceGroups(zones []dns.Zone) {
+	c.zoneLock.Lock()
+	defer c.zoneLock.Unlock()
+
+	for _, zone := range zones {
+		if zone.Name == nil || zone.ID == nil {
+			continue
+		}
+		rg := resourceGroupFromID(*zone.ID)
+		if rg == "" || hasGroup(c.zoneGroups[*zone.Name], rg) {
+			continue
+		}
+		if c.zoneGroups[*zone.Name] == nil {
+			c.zoneGroups[*zone.Name] = make(map[string]bool)
+		}
+		c.zoneGroups[*zone.Name][rg] = true
+	}
+}
+
+// resourceGroup returns the resource group of the zone: the group ctx is routed to,
+// else the configured resource group if the zone wasn't listed elsewhere, else the
+// single group the zone was listed in. Zones listed in several other groups are
+// ambiguous and "" is returned with ErrAmbiguousZone.
+func (c *DNSAPI) resourceGroup(ctx context.Context, zoneName string) (string, error) {
+	if rg, ok := resourceGroupFromContext(ctx); ok {
+		return rg, nil
+	}
+
+	c.zoneLock.RLock()
+	defer c.zoneLock.RUnlock()
+
+	groups := c.zoneGroups[zoneName]
+	if len(groups) == 0 || hasGroup(groups, c.conf.Global.ResourceGroup) {
+		return c.conf.Global.ResourceGroup, nil
+	}
+	if len(groups) > 1 {
+		return "", fmt.Errorf("%w: %s, look it up with List", ErrAmbiguousZone, zoneName)
+	}
+	for rg := range groups {
+		return rg, nil
+	}
+	return "", nil
+}
+
+// forgetZone drops the recorded resource group rg of a deleted zone
+func (c *DNSAPI) forgetZone(zoneName string, rg string) {
+	c.zoneLock.Lock()
+	defer c.zoneLock.Unlock()
+	for group := range c.zoneGroups[zoneName] {
+		if strings.EqualFold(group, rg) {
+			delete(c.zoneGroups[zoneName], group)
+		}
+	}
+	if len(c.zoneGroups[zoneName]) == 0 {
+		delete(c.zoneGroups, zoneName)
+	}
+}
+
+// hasGroup reports whether groups contains rg, resource group names are case insensitive
+func hasGroup(groups map[string]bool, rg string) bool {
+	for group := range groups {
+		if strings.EqualFold(group, rg) {
+			return true
+		}
+	}
+	return false
 }
 
 // CreateOrUpdateZone creates or updates a zone
 func (c *DNSAPI) CreateOrUpdateZone(zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error) {
-	glog.V(4).Infof("azuredns: Creating Zone: %s, in resource group: %s\n", zoneName, c.conf.Global.ResourceGroup)
-	return c.zc.CreateOrUpdate(c.conf.Global.ResourceGroup, zoneName, zone, ifMatch, ifNoneMatch)
+	return c.CreateOrUpdateZoneWithContext(context.Background(), zoneName, zone, ifMatch, ifNoneMatch)
 }
 
-// DeleteZone deletes a Zone from the configured Azure resource group
+// CreateOrUpdateZoneWithContext creates or updates a zone, giving up when ctx is done
+func (c *DNSAPI) CreateOrUpdateZoneWithContext(ctx context.Context, zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (result dns.Zone, err error) {
+	rg, err := c.resourceGroup(ctx, zoneName)
+	if err != nil {
+		return result, err
+	}
+	if rg == "" {
+		// subscription-wide zones don't require a default resource group
+		return result, fmt.Errorf("%w: resourceGroup not set, cannot create zone %s", ErrInvalidConfig, zoneName)
+	}
+	withFields(fieldZone, zoneName, fieldResourceGroup, rg).info(4, "Creating or updating zone")
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if err = c.waitForWrite(ctx); err != nil {
+		return result, err
+	}
+
+	err = c.send(ctx, apiCall{operation: "CreateOrUpdateZone", zone: zoneName}, "dns.ZonesClient", "CreateOrUpdate",
+		func() (*http.Request, error) {
+			return c.zc.CreateOrUpdatePreparer(rg, zoneName, zone, ifMatch, ifNoneMatch)
+		},
+		c.zc.CreateOrUpdateSender,
+		func(resp *http.Response) error {
+			result, err = c.zc.CreateOrUpdateResponder(resp)
+			return err
+		})
+	return result, err
+}
+
+// DeleteZone deletes a Zone from its Azure resource group
 func (c *DNSAPI) DeleteZone(zoneName string, ifMatch string, cancel <-chan struct{}) (<-chan dns.ZoneDeleteResult, <-chan error) {
-	glog.V(4).Infof("azuredns: Removing Azure DNS zone Name: %s rg: %s\n", zoneName, c.conf.Global.ResourceGroup)
-	return c.zc.Delete(c.conf.Global.ResourceGroup, zoneName, ifMatch, cancel)
+	return deleteZoneAsync(cancel, func(ctx context.Context) (dns.ZoneDeleteResult, error) {
+		return c.DeleteZoneWithContext(ctx, zoneName, ifMatch)
+	})
+}
+
+// DeleteZoneWithContext deletes a Zone from its Azure resource group and
+// waits for the deletion to complete, giving up when ctx is done
+func (c *DNSAPI) DeleteZoneWithContext(ctx context.Context, zoneName string, ifMatch string) (dns.ZoneDeleteResult, error) {
+	rg, err := c.resourceGroup(ctx, zoneName)
+	if err != nil {
+		return dns.ZoneDeleteResult{}, err
+	}
+	withFields(fieldZone, zoneName, fieldResourceGroup, rg).info(4, "Deleting zone")
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if err := c.waitForWrite(ctx); err != nil {
+		return dns.ZoneDeleteResult{}, err
+	}
+
+	// the long running delete operation polls until ctx.Done() is closed
+	call := apiCall{operation: "DeleteZone", zone: zoneName}
+	_, span := c.startCall(ctx, call)
+	start := time.Now()
+	results, errs := c.zc.Delete(rg, zoneName, ifMatch, ctx.Done())
+	result := <-results
+	err = <-errs
+	c.metrics.observeRequest(call, start, result.Response.Response, err)
+	logRequest(call, start, result.Response.Response, err)
+	setResponseAttributes(span, result.Response.Response)
+	endSpan(span, err)
+	if err != nil {
+		return result, err
+	}
+	c.forgetZone(zoneName, rg)
+	return result, nil
+}
+
+// setCredentials authenticates the clients with the credentials from config.
+// Requests that are already in flight keep using the previous credentials.
+func (c *DNSAPI) setCredentials(config Config) error {
+	env, err := azureEnvironment(config)
+	if err != nil {
+		return err
+	}
+
+	spt, err := newServicePrincipalToken(config, env.ResourceManagerEndpoint)
+	if err != nil {
+		return err
+	}
+
+	c.auth.set(autorest.NewBearerAuthorizer(newTokenProvider(spt, c.tokenRefreshFailed)), principalOf(config))
+	return nil
+}
+
+// OnTokenRefreshError registers a function called whenever refreshing the
+// shared access token fails
+func (c *DNSAPI) OnTokenRefreshError(hook func(error)) {
+	c.hookLock.Lock()
+	defer c.hookLock.Unlock()
+	c.onRefreshError = hook
+}
+
+// principal returns the identity the requests are authenticated as,
+// which changes when the credentials are reloaded
+func (c *DNSAPI) principal() string {
+	return c.auth.identity()
+}
+
+// principalOf returns the identity the credentials of config authenticate as
+func principalOf(config Config) string {
+	global := config.Global
+	if global.UseManagedIdentity {
+		if global.UserAssignedIdentityID != "" {
+			return "managed-identity:" + global.UserAssignedIdentityID
+		}
+		return "managed-identity"
+	}
+	return global.ClientID
+}
+
+func (c *DNSAPI) tokenRefreshFailed(err error) {
+	withFields(fieldSubscription, c.conf.Global.SubscriptionID).
+		warning("Refreshing the Azure access token failed", fieldError, err)
+
+	c.hookLock.RLock()
+	hook := c.onRefreshError
+	c.hookLock.RUnlock()
+	if hook != nil {
+		hook(err)
+	}
 }
 
 // New initializes a new API interface from the --dns-provider-config
 // The --dns-provider-config option is required.
 // In the future, we could try inferring defaults.
-func New(config Config) *Interface {
-	api := &DNSAPI{}
+func New(config Config) (*Interface, error) {
+	configs, err := config.subscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	iface := &Interface{metrics: newMetrics(), tracing: &tracing{}, audit: &auditing{}, background: newBackground()}
+	if path := config.Global.AuditLogFile; path != "" {
+		sink, err := NewFileAuditSink(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		iface.SetAuditSink(sink)
+		iface.auditFile = sink
+	}
 
-	glog.V(4).Infof("azuredns: Created Azure DNS DNSAPI for subscription: %s", config.Global.SubscriptionID)
+	for _, subConfig := range configs {
+		api, err := newDNSAPI(subConfig, iface.metrics, iface.tracing, iface.background)
+		if err != nil {
+			// stop the watchers of the subscriptions created so far
+			// and close the audit log
+			iface.Close()
+			return nil, err
+		}
+		sub := subscription{name: subConfig.name, service: newService(api, subConfig, iface.background), api: api}
+		if iface.service == nil {
+			iface.service, iface.api = sub.service, sub.api
+		}
+		if len(config.Subscription) > 0 {
+			iface.subscriptions = append(iface.subscriptions, sub)
+		}
+	}
+	return iface, nil
+}
+
+// newService decorates the DNSAPI with retries and the optional cache,
+// whose resync loop runs in bg
+func newService(api *DNSAPI, config Config, bg *background) azurestub.API {
+	var service azurestub.API = newRetryAPI(api, newRetryPolicy(config))
+
+	if ttl := durationOrDefault(config.Global.CacheTTL, 0); ttl > 0 {
+		cache := newCacheAPI(service, ttl, func(ctx context.Context, zoneName string) string {
+			// requests for ambiguous zones fail and share the key of the name
+			rg, _ := api.resourceGroup(ctx, zoneName)
+			return rg
+		})
+		if interval := durationOrDefault(config.Global.CacheResyncInterval, 0); interval > 0 {
+			bg.goUntilStopped(func(stopCh <-chan struct{}) {
+				cache.run(interval, stopCh)
+			})
+		}
+		service = cache
+	}
+	return service
+}
+
+// newDNSAPI creates the API of the subscription configured in [Global],
+// its credential watcher runs in bg
+func newDNSAPI(config Config, m *metrics, t *tracing, bg *background) (*DNSAPI, error) {
+	api := &DNSAPI{
+		metrics:      m,
+		tracing:      t,
+		auth:         &reloadableAuthorizer{},
+		readLimiter:  newRateLimiter(config.Global.ReadsPerSecond),
+		writeLimiter: newRateLimiter(config.Global.WritesPerSecond),
+		timeout:      durationOrDefault(config.Global.RequestTimeout, defaultRequestTimeout),
+		zoneGroups:   make(map[string]map[string]bool),
+	}
+
+	log := withFields(fieldSubscription, config.Global.SubscriptionID)
+	log.info(4, "Creating Azure DNS API")
 	api.conf = config
 
-	api.zc = dns.NewZonesClient(config.Global.SubscriptionID)
-	spt, err := NewServicePrincipalTokenFromCredentials(config, azure.PublicCloud.ResourceManagerEndpoint)
+	env, err := azureEnvironment(config)
 	if err != nil {
-		glog.Fatalf("azuredns: Error authenticating to Azure DNS: %v", err)
-		return nil
+		return nil, err
 	}
 
-	api.zc.Authorizer = autorest.NewBearerAuthorizer(spt)
+	api.zc = dns.NewZonesClientWithBaseURI(env.ResourceManagerEndpoint, config.Global.SubscriptionID)
+	api.zc.Authorizer = api.auth
 
-	api.rc = dns.NewRecordSetsClient(config.Global.SubscriptionID)
-	spt, err = NewServicePrincipalTokenFromCredentials(config, azure.PublicCloud.ResourceManagerEndpoint)
-	if err != nil {
-		glog.Fatalf("azuredns: Error authenticating to Azure DNS: %v", err)
-		return nil
+	api.rc = dns.NewRecordSetsClientWithBaseURI(env.ResourceManagerEndpoint, config.Global.SubscriptionID)
+	api.rc.Authorizer = api.auth
+
+	if err := api.setCredentials(config); err != nil {
+		log.error("Authenticating to Azure DNS failed", err)
+		return nil, err
+	}
+
+	if config.Global.SecretFile != "" || config.Global.WatchConfigFile != "" {
+		bg.goUntilStopped(newConfigWatcher(api, config).run)
 	}
 
-	api.rc.Authorizer = autorest.NewBearerAuthorizer(spt)
-	return &Interface{service: api}
+	return api, nil
 }
 
 func checkEnvVar(envVars *map[string]string) error {
@@ -162,7 +836,8 @@ func checkEnvVar(envVars *map[string]string) error {
 		}
 	}
 	if len(missingVars) > 0 {
-		return fmt.Errorf("azuredns: Missing environment variables %v", missingVars)
+		sort.Strings(missingVars)
+		return fmt.Errorf("%w: %v not set in the dns-provider-config, the environment or $HOME%s", ErrMissingCredentials, missingVars, credentialsPath)
 	}
 	return nil
 }
@@ -0,0 +1,213 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/golang/glog"
+)
+
+// Log field keys
+const (
+	fieldZone          = "zone"
+	fieldName          = "name"
+	fieldType          = "type"
+	fieldTTL           = "ttl"
+	fieldRrdatas       = "rrdatas"
+	fieldOperation     = "operation"
+	fieldResourceGroup = "resource_group"
+	fieldSubscription  = "subscription"
+	fieldRequestID     = "request_id"
+	fieldStatus        = "status"
+	fieldDuration      = "duration"
+	fieldError         = "error"
+)
+
+// redacted replaces secrets whenever a config is logged
+const redacted = "<redacted>"
+
+// logger writes glog lines made of a message followed by key/value fields,
+// e.g. `azuredns: Deleting record set zone=example.com name=www type=A`
+type logger struct {
+	fields []interface{}
+}
+
+// withFields returns a logger adding the alternating keys and values to each line
+func withFields(keysAndValues ...interface{}) logger {
+	return logger{}.with(keysAndValues...)
+}
+
+// with returns a logger adding the keys and values to the fields of l
+func (l logger) with(keysAndValues ...interface{}) logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	return logger{fields: append(fields, keysAndValues...)}
+}
+
+// info logs msg if the verbosity is at least level
+func (l logger) info(level glog.Level, msg string, keysAndValues ...interface{}) {
+	if glog.V(level) {
+		glog.InfoDepth(1, l.format(msg, keysAndValues))
+	}
+}
+
+func (l logger) warning(msg string, keysAndValues ...interface{}) {
+	glog.WarningDepth(1, l.format(msg, keysAndValues))
+}
+
+// error logs msg with err and, for failed ARM requests, the request ID
+func (l logger) error(msg string, err error, keysAndValues ...interface{}) {
+	if id := requestID(responseOf(err)); id != "" {
+		keysAndValues = append(keysAndValues, fieldRequestID, id)
+	}
+	keysAndValues = append(keysAndValues, fieldError, err)
+	glog.ErrorDepth(1, l.format(msg, keysAndValues))
+}
+
+func (l logger) format(msg string, keysAndValues []interface{}) string {
+	var b bytes.Buffer
+	b.WriteString("azuredns: ")
+	b.WriteString(msg)
+	writeFields(&b, l.fields)
+	writeFields(&b, keysAndValues)
+	return b.String()
+}
+
+func writeFields(b *bytes.Buffer, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "<missing>"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fmt.Fprintf(b, " %v=%s", keysAndValues[i], formatValue(value))
+	}
+}
+
+// formatValue quotes values that would otherwise be ambiguous in a line
+func formatValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case *string:
+		if v == nil {
+			return `""`
+		}
+		s = *v
+	case *int64:
+		if v == nil {
+			return "0"
+		}
+		s = fmt.Sprint(*v)
+	case time.Duration:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// recordSetFields returns the log fields of a record set of zone
+func recordSetFields(zone string, rset *dns.RecordSet) []interface{} {
+	fields := []interface{}{fieldZone, zone, fieldName, rset.Name, fieldType, rset.Type}
+	if rset.RecordSetProperties != nil && rset.TTL != nil {
+		fields = append(fields, fieldTTL, *rset.TTL)
+	}
+	return fields
+}
+
+// logRequest logs an ARM request and its outcome
+func logRequest(call apiCall, start time.Time, resp *http.Response, err error) {
+	if !glog.V(4) {
+		return
+	}
+	fields := []interface{}{
+		fieldOperation, call.operation,
+		fieldZone, call.zone,
+		fieldName, call.name,
+		fieldType, string(call.recordType),
+		fieldDuration, time.Since(start),
+	}
+	if resp != nil {
+		fields = append(fields, fieldStatus, resp.StatusCode)
+	}
+	if id := requestID(resp); id != "" {
+		fields = append(fields, fieldRequestID, id)
+	}
+	if err := call.failure(err); err != nil {
+		fields = append(fields, fieldError, err)
+	}
+	glog.InfoDepth(1, logger{}.format("ARM request", fields))
+}
+
+// requestID returns the ARM request ID of resp
+func requestID(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get("x-ms-request-id")
+}
+
+// responseOf returns the response of a failed ARM request
+func responseOf(err error) *http.Response {
+	var detailed autorest.DetailedError
+	if errors.As(err, &detailed) {
+		return detailed.Response
+	}
+	return nil
+}
+
+// String formats the config with its secrets redacted
+func (c Config) String() string {
+	global := c.Global
+	redact(&global.Secret)
+	redact(&global.ClientCertificatePassword)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "{Global:%+v", global)
+	for _, name := range c.subscriptionNames() {
+		if sub := c.Subscription[name]; sub != nil {
+			fmt.Fprintf(&b, " Subscription %q:%+v", name, *sub)
+		}
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// String formats the subscription section with its secrets redacted
+func (c SubscriptionConfig) String() string {
+	type plain SubscriptionConfig
+	sub := plain(c)
+	redact(&sub.Secret)
+	redact(&sub.ClientCertificatePassword)
+	return fmt.Sprintf("%+v", sub)
+}
+
+func redact(secret *string) {
+	if *secret != "" {
+		*secret = redacted
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+/* TestConfigRedacted verifies that secrets never appear in a logged config */
+func TestConfigRedacted(t *testing.T) {
+	config, err := readConfig(testConfig("client-certificate-password = certpass\n" +
+		"[Subscription \"other\"]\nsubscription-id = other\nsecret = othersecret\n"))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	for _, logged := range []string{
+		config.String(),
+		fmt.Sprintf("%v", config),
+		fmt.Sprintf("%+v", config),
+		withFields("config", config).format("Loaded config", nil),
+	} {
+		for _, secret := range []string{"secret", "certpass", "othersecret"} {
+			if strings.Contains(logged, "Secret:"+secret) || strings.Contains(logged, ":"+secret+" ") {
+				t.Errorf("Logged config %q contains the secret %q", logged, secret)
+			}
+		}
+		if !strings.Contains(logged, redacted) || !strings.Contains(logged, "SubscriptionID:other") {
+			t.Errorf("Logged config %q is not redacted or misses the subscription section", logged)
+		}
+	}
+}
+
+/* TestLogFields verifies the formatting of the key/value fields */
+func TestLogFields(t *testing.T) {
+	rset := &dns.RecordSet{
+		Name:                to.StringPtr("www"),
+		Type:                to.StringPtr("A"),
+		RecordSetProperties: &dns.RecordSetProperties{TTL: to.Int64Ptr(180)},
+	}
+	got := withFields(recordSetFields("example.com", rset)...).
+		with(fieldOperation, "add").
+		format("Applying change", []interface{}{fieldRrdatas, []string{"10.0.0.1", "10.0.0.2"}, "empty", ""})
+	want := `azuredns: Applying change zone=example.com name=www type=A ttl=180 operation=add rrdatas="[10.0.0.1 10.0.0.2]" empty=""`
+	if got != want {
+		t.Errorf("Got log line %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "azuredns"
+
+// apiCall describes an ARM request for the metrics and traces
+type apiCall struct {
+	operation  string
+	zone       string
+	name       string
+	recordType dns.RecordType
+	// lookup marks requests for which a 404 is an expected miss
+	lookup bool
+}
+
+// failure returns err unless it is the expected miss of a lookup
+func (call apiCall) failure(err error) error {
+	if call.lookup && isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// metrics holds the Prometheus collectors of an Interface, shared by the
+// DNSAPIs of all its subscriptions. A nil *metrics records nothing.
+type metrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	zoneRecordSets  *prometheus.GaugeVec
+	changesetSize   *prometheus.GaugeVec
+	reloads         *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	apiLabels := []string{"operation", "zone", "record_type", "result", "code"}
+	return &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_requests_total",
+			Help:      "Number of Azure DNS API requests.",
+		}, apiLabels),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of Azure DNS API requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, apiLabels),
+		zoneRecordSets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "zone_record_sets",
+			Help:      "Number of record sets in a zone when it was last listed.",
+		}, []string{"zone"}),
+		changesetSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "changeset_size",
+			Help:      "Number of changes by kind in the last changeset applied to a zone.",
+		}, []string{"zone", "change"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "credential_reloads_total",
+			Help:      "Number of credential reloads after the config or secret file changed.",
+		}, []string{"subscription", "result"}),
+	}
+}
+
+// register registers the collectors with registerer
+func (m *metrics) register(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{m.requests, m.requestDuration, m.zoneRecordSets, m.changesetSize, m.reloads} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeRequest records an ARM request that started at start and ended with
+// the response resp, which may be nil, and err
+func (m *metrics) observeRequest(call apiCall, start time.Time, resp *http.Response, err error) {
+	if m == nil {
+		return
+	}
+
+	result := "success"
+	switch {
+	case call.failure(err) != nil:
+		result = "error"
+	case err != nil:
+		result = "not_found"
+	}
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	} else if err != nil {
+		statusCode, _ = errorStatus(err)
+	}
+	code := "none"
+	if statusCode > 0 {
+		code = strconv.Itoa(statusCode)
+	}
+
+	labels := prometheus.Labels{
+		"operation":   call.operation,
+		"zone":        call.zone,
+		"record_type": string(call.recordType),
+		"result":      result,
+		"code":        code,
+	}
+	m.requests.With(labels).Inc()
+	m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+}
+
+// observeReload records a credential reload of subscription that ended with err
+func (m *metrics) observeReload(subscription string, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.reloads.WithLabelValues(subscription, result).Inc()
+}
+
+// setZoneRecordSets records the number of record sets listed in a zone
+func (m *metrics) setZoneRecordSets(zone string, count int) {
+	if m == nil {
+		return
+	}
+	m.zoneRecordSets.WithLabelValues(zone).Set(float64(count))
+}
+
+// setChangesetSize records the size of a changeset applied to a zone
+func (m *metrics) setChangesetSize(zone string, removals, upserts, additions int) {
+	if m == nil {
+		return
+	}
+	m.changesetSize.WithLabelValues(zone, "removal").Set(float64(removals))
+	m.changesetSize.WithLabelValues(zone, "upsert").Set(float64(upserts))
+	m.changesetSize.WithLabelValues(zone, "addition").Set(float64(additions))
+}
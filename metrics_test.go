@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/kubernetes/federation/pkg/dnsprovider/rrstype"
+)
+
+/* TestMetrics verifies that requests and changesets are recorded on the registry */
+func TestMetrics(t *testing.T) {
+	iface, closeAll := newARMTestInterface(t, "retry-max-attempts = 1\n", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/AAAA/") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprint(w, `{"value": [{"name": "www", "type": "A"}, {"name": "api", "type": "A"}]}`)
+	})
+	defer closeAll()
+	registry := prometheus.NewRegistry()
+	if err := iface.RegisterMetrics(registry); err != nil {
+		t.Fatalf("Failed to register metrics: %v", err)
+	}
+
+	iface.service.DeleteRecordSet("test.com", "www", dns.A, "")
+	iface.service.GetRecordSet("test.com", "www", dns.AAAA)
+	iface.service.ListResourceRecordSetsByZone("test.com")
+
+	requests := iface.metrics.requests
+	if n := testutil.ToFloat64(requests.WithLabelValues("DeleteRecordSet", "test.com", "A", "success", "200")); n != 1 {
+		t.Errorf("Got %v successful DeleteRecordSet requests, expected 1", n)
+	}
+	if n := testutil.ToFloat64(requests.WithLabelValues("GetRecordSet", "test.com", "AAAA", "not_found", "404")); n != 1 {
+		t.Errorf("Got %v GetRecordSet misses, expected 1", n)
+	}
+	if n := testutil.ToFloat64(iface.metrics.zoneRecordSets.WithLabelValues("test.com")); n != 2 {
+		t.Errorf("Got %v record sets for the zone, expected 2", n)
+	}
+
+	zones, _ := iface.Zones()
+	zone, _ := zones.New("test.com")
+	rrsets, _ := zone.ResourceRecordSets()
+	changeset := rrsets.StartChangeset()
+	changeset.Add(rrsets.New("a.test.com", []string{"10.0.0.1"}, 180, rrstype.A))
+	changeset.Add(rrsets.New("b.test.com", []string{"10.0.0.2"}, 180, rrstype.A))
+	changeset.Upsert(rrsets.New("c.test.com", []string{"10.0.0.3"}, 180, rrstype.A))
+	if err := changeset.Apply(); err != nil {
+		t.Fatalf("Failed to apply changeset: %v", err)
+	}
+	if n := testutil.ToFloat64(iface.metrics.changesetSize.WithLabelValues("test.com", "addition")); n != 2 {
+		t.Errorf("Got changeset size %v for additions, expected 2", n)
+	}
+
+	count, err := testutil.GatherAndCount(registry, "azuredns_api_requests_total", "azuredns_api_request_duration_seconds")
+	if err != nil || count == 0 {
+		t.Errorf("Got %d gathered series (%v), expected the request metrics on the registry", count, err)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Compile time check for interface adherence
+var _ autorest.Authorizer = &reloadableAuthorizer{}
+
+// reloadableAuthorizer is an autorest.Authorizer whose underlying
+// authorizer can be replaced while requests are being sent.
+type reloadableAuthorizer struct {
+	lock       sync.RWMutex
+	authorizer autorest.Authorizer
+	// principal is the identity authorizer authenticates as
+	principal string
+}
+
+// WithAuthorization returns the PrepareDecorator of the current authorizer
+func (a *reloadableAuthorizer) WithAuthorization() autorest.PrepareDecorator {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.authorizer.WithAuthorization()
+}
+
+func (a *reloadableAuthorizer) set(authorizer autorest.Authorizer, principal string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.authorizer = authorizer
+	a.principal = principal
+}
+
+// identity returns the principal of the current authorizer
+func (a *reloadableAuthorizer) identity() string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.principal
+}
+
+// readSecretFile returns the service principal secret stored in path
+func readSecretFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: reading secret file %q: %v", ErrInvalidConfig, path, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// configWatcher polls the dns-provider-config and the secret file it references
+// and reloads the credentials of a DNSAPI when either changes.
+type configWatcher struct {
+	api      *DNSAPI
+	config   Config
+	interval time.Duration
+	modTimes map[string]time.Time
+}
+
+func newConfigWatcher(api *DNSAPI, config Config) *configWatcher {
+	w := &configWatcher{
+		api:      api,
+		config:   config,
+		interval: durationOrDefault(config.Global.ReloadInterval, defaultReloadInterval),
+		modTimes: make(map[string]time.Time),
+	}
+	// record the current state of the files so that the first poll doesn't reload
+	w.changed()
+	return w
+}
+
+// run polls for changes until stopCh is closed
+func (w *configWatcher) run(stopCh <-chan struct{}) {
+	withFields("paths", w.paths(), "interval", w.interval).info(2, "Watching for credential changes")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll reloads the credentials if a watched file changed
+func (w *configWatcher) poll() {
+	if !w.changed() {
+		return
+	}
+
+	err := w.reload()
+	w.api.metrics.observeReload(w.config.Global.SubscriptionID, err)
+	log := withFields(fieldSubscription, w.config.Global.SubscriptionID)
+	if err != nil {
+		log.error("Reloading credentials failed, keeping the previous credentials", err)
+		return
+	}
+	log.info(0, "Reloaded credentials")
+}
+
+// reload reads the watched files and swaps the credentials of the DNSAPI.
+// Only the credentials are reloaded, other changes need a restart.
+func (w *configWatcher) reload() error {
+	config := w.config
+
+	if path := w.config.Global.WatchConfigFile; path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if config, err = loadConfig(f); err != nil {
+			return err
+		}
+		// pick the section of this API's subscription
+		if config, err = config.subscription(w.config.name); err != nil {
+			return err
+		}
+	} else {
+		secret, err := readSecretFile(config.Global.SecretFile)
+		if err != nil {
+			return err
+		}
+		config.Global.Secret = secret
+	}
+
+	if err := w.api.setCredentials(config); err != nil {
+		return err
+	}
+	w.config = config
+	return nil
+}
+
+func (w *configWatcher) paths() []string {
+	var paths []string
+	if w.config.Global.WatchConfigFile != "" {
+		paths = append(paths, w.config.Global.WatchConfigFile)
+	}
+	if w.config.Global.SecretFile != "" {
+		paths = append(paths, w.config.Global.SecretFile)
+	}
+	return paths
+}
+
+// changed records the modification times of the watched files and reports
+// whether any of them differs from the previous call
+func (w *configWatcher) changed() bool {
+	changed := false
+	for _, path := range w.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			withFields("path", path).info(4, "Cannot stat watched file", fieldError, err)
+			continue
+		}
+		if modTime, ok := w.modTimes[path]; !ok || !modTime.Equal(info.ModTime()) {
+			w.modTimes[path] = info.ModTime()
+			changed = true
+		}
+	}
+	return changed
+}
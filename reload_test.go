@@ -0,0 +1,150 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func authorizationHeader(t *testing.T, authorizer autorest.Authorizer) string {
+	req, err := autorest.Prepare(&http.Request{}, autorest.WithBaseURL("https://example.com"), authorizer.WithAuthorization())
+	if err != nil {
+		t.Fatalf("Failed to authorize request: %v", err)
+	}
+	return req.Header.Get("Authorization")
+}
+
+// newSecretFileInterface returns an Interface reading its client secret
+// "one" from a file polled every interval, the config it was created from
+// and the path of the secret file. The returned function closes the
+// interface and removes the file.
+func newSecretFileInterface(t *testing.T, interval string) (*Interface, Config, string, func()) {
+	aad := newFakeAAD()
+	dir, err := ioutil.TempDir("", "azuredns")
+	if err != nil {
+		aad.Close()
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+		aad.Close()
+	}
+
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("one\n"), 0600); err != nil {
+		cleanup()
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	config, err := loadConfig(strings.NewReader("[Global]\nsubscription-id = sub\ntenant-id = tenant\nclient-id = client\nresourceGroup = rg\n" +
+		"secret-file = " + secretFile + "\nreload-interval = " + interval + "\nactive-directory-endpoint = " + aad.URL + "/\n"))
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	iface, err := New(config)
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to create interface: %v", err)
+	}
+	return iface, config, secretFile, func() {
+		iface.Close()
+		cleanup()
+	}
+}
+
+// rotateSecret writes secret to the secret file with a later modification time
+func rotateSecret(t *testing.T, secretFile string, secret string) {
+	if err := ioutil.WriteFile(secretFile, []byte(secret+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(secretFile, later, later)
+}
+
+/* TestReloadSecretFile verifies that a changed secret file swaps the credentials of both clients */
+func TestReloadSecretFile(t *testing.T) {
+	iface, config, secretFile, cleanup := newSecretFileInterface(t, "1h")
+	defer cleanup()
+	api := iface.api
+	if got := authorizationHeader(t, api.auth); got != "Bearer token-one" {
+		t.Errorf("Got authorization %q before reload", got)
+	}
+
+	reloads := iface.metrics.reloads
+	w := newConfigWatcher(api, config)
+	w.poll()
+	if n := testutil.ToFloat64(reloads.WithLabelValues("sub", "success")); n != 0 {
+		t.Errorf("Reloaded %v times without changes", n)
+	}
+
+	rotateSecret(t, secretFile, "two")
+	w.poll()
+	if n := testutil.ToFloat64(reloads.WithLabelValues("sub", "success")); n != 1 {
+		t.Errorf("Got %v reloads, expected 1", n)
+	}
+	if n := testutil.ToFloat64(reloads.WithLabelValues("sub", "error")); n != 0 {
+		t.Errorf("Got %v failed reloads, expected none", n)
+	}
+	for _, authorizer := range []autorest.Authorizer{api.zc.Authorizer, api.rc.Authorizer} {
+		if got := authorizationHeader(t, authorizer); got != "Bearer token-two" {
+			t.Errorf("Got authorization %q after reload", got)
+		}
+	}
+}
+
+/* TestReloadPrincipal verifies that audit events name the principal of the reloaded credentials */
+func TestReloadPrincipal(t *testing.T) {
+	iface, config, _, cleanup := newSecretFileInterface(t, "1h")
+	defer cleanup()
+	if got := iface.auditEvent(iface.service, AuditAddRecordSet, "test.com").Principal; got != "client" {
+		t.Errorf("Got principal %q before reload, expected client", got)
+	}
+
+	config.Global.ClientID = "rotated"
+	if err := iface.api.setCredentials(config); err != nil {
+		t.Fatalf("Failed to reload credentials: %v", err)
+	}
+	if got := iface.auditEvent(iface.service, AuditAddRecordSet, "test.com").Principal; got != "rotated" {
+		t.Errorf("Got principal %q after reload, expected rotated", got)
+	}
+}
+
+/* TestCloseStopsWatcher verifies that Close stops reloading the credentials */
+func TestCloseStopsWatcher(t *testing.T) {
+	iface, _, secretFile, cleanup := newSecretFileInterface(t, "10ms")
+	defer cleanup()
+	if err := iface.Close(); err != nil {
+		t.Fatalf("Failed to close interface: %v", err)
+	}
+
+	rotateSecret(t, secretFile, "two")
+	time.Sleep(50 * time.Millisecond)
+
+	if got := authorizationHeader(t, iface.api.auth); got != "Bearer token-one" {
+		t.Errorf("Got authorization %q, expected no reload after Close", got)
+	}
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
+)
+
+// Retry policy defaults
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = time.Second
+	defaultRetryMaxDelay    = 30 * time.Second
+	defaultRetryJitter      = 0.2
+)
+
+// retryPolicy describes how failed Azure DNS API calls are retried
+type retryPolicy struct {
+	// maxAttempts is the number of attempts including the first call
+	maxAttempts int
+	// the delay doubles with every retry starting at baseDelay, up to maxDelay
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// jitter is the fraction of the delay that is randomized
+	jitter float64
+	// honorRetryAfter uses the Retry-After response header as delay when set
+	honorRetryAfter bool
+	// timeout bounds a call including its retries when the context has no
+	// deadline, zero means unbounded
+	timeout time.Duration
+}
+
+// newRetryPolicy returns the retry policy configured in config
+func newRetryPolicy(config Config) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:     config.Global.RetryMaxAttempts,
+		baseDelay:       durationOrDefault(config.Global.RetryBaseDelay, defaultRetryBaseDelay),
+		maxDelay:        durationOrDefault(config.Global.RetryMaxDelay, defaultRetryMaxDelay),
+		jitter:          config.Global.RetryJitter,
+		honorRetryAfter: !config.Global.IgnoreRetryAfter,
+		timeout:         durationOrDefault(config.Global.RequestTimeout, defaultRequestTimeout),
+	}
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = defaultRetryMaxAttempts
+	}
+	switch {
+	case policy.jitter == 0:
+		policy.jitter = defaultRetryJitter
+	case policy.jitter < 0:
+		policy.jitter = 0
+	case policy.jitter > 1:
+		policy.jitter = 1
+	}
+	return policy
+}
+
+// delay returns how long to wait before the given retry, starting at 1
+func (p retryPolicy) delay(retry int, err error) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < retry && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	delay -= time.Duration(p.jitter * rand.Float64() * float64(delay))
+
+	if p.honorRetryAfter {
+		if _, resp := errorStatus(err); resp != nil && resp.Header.Get("Retry-After") != "" {
+			delay = autorest.GetRetryAfter(resp, delay)
+		}
+	}
+	// Retry-After is honored up to maxDelay as well
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay
+}
+
+// sendFailure is the message of autorest errors for requests that couldn't be sent
+const sendFailure = "Failure sending request"
+
+// isRetriable reports whether a failed call may succeed when retried:
+// ARM throttling, server errors and requests that couldn't be sent
+func isRetriable(err error) bool {
+	statusCode, resp := errorStatus(err)
+	if statusCode < 0 {
+		// not an Azure error, e.g. from the mock implementation
+		return false
+	}
+
+	switch statusCode {
+	case autorest.UndefinedStatusCode:
+		return resp == nil && isSendFailure(err)
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isPreconditionFailed reports whether err is an Azure error with status 412
+func isPreconditionFailed(err error) bool {
+	statusCode, _ := errorStatus(err)
+	return statusCode == http.StatusPreconditionFailed
+}
+
+// isNotFound reports whether err is an Azure error with status 404
+func isNotFound(err error) bool {
+	statusCode, _ := errorStatus(err)
+	return statusCode == http.StatusNotFound
+}
+
+// isSendFailure reports whether err is a transport failure sending the
+// request. Preparation and rate limiter errors aren't, neither are
+// requests aborted because their context is done.
+func isSendFailure(err error) bool {
+	detailed, ok := detailedError(err)
+	if !ok || detailed.Message != sendFailure {
+		return false
+	}
+	return !errors.Is(detailed.Original, context.Canceled) && !errors.Is(detailed.Original, context.DeadlineExceeded)
+}
+
+// detailedError returns the autorest.DetailedError of an Azure error
+func detailedError(err error) (autorest.DetailedError, bool) {
+	switch e := err.(type) {
+	case autorest.DetailedError:
+		return e, true
+	case *autorest.DetailedError:
+		return *e, true
+	case *azure.RequestError:
+		return e.DetailedError, true
+	}
+	return autorest.DetailedError{}, false
+}
+
+// errorStatus returns the HTTP status code and response of an Azure error.
+// The status code is -1 for errors not returned by autorest.
+func errorStatus(err error) (int, *http.Response) {
+	detailed, ok := detailedError(err)
+	if !ok {
+		return -1, nil
+	}
+
+	if detailed.Response != nil {
+		return detailed.Response.StatusCode, detailed.Response
+	}
+	if statusCode, ok := detailed.StatusCode.(int); ok {
+		return statusCode, nil
+	}
+	return autorest.UndefinedStatusCode, nil
+}
+
+// Compile time check for interface adherence
+var _ azurestub.API = &retryAPI{}
+
+// retryAPI decorates an API, retrying calls that failed with transient errors
+// with exponential backoff
+type retryAPI struct {
+	api    azurestub.API
+	policy retryPolicy
+	// sleep waits for the delay, it returns false if cancelled
+	sleep func(delay time.Duration, cancel <-chan struct{}) bool
+}
+
+func newRetryAPI(api azurestub.API, policy retryPolicy) *retryAPI {
+	return &retryAPI{
+		api:    api,
+		policy: policy,
+		sleep:  sleep,
+	}
+}
+
+func sleep(delay time.Duration, cancel <-chan struct{}) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// do calls f until it succeeds, fails with a permanent error,
+// the attempts are exhausted or ctx is done. Without a deadline, ctx is
+// bounded by the request timeout across all attempts and delays.
+func (r *retryAPI) do(ctx context.Context, operation string, f func(ctx context.Context) error) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil || ctx.Err() != nil || attempt >= r.policy.maxAttempts || !isRetriable(err) {
+			return err
+		}
+
+		delay := r.policy.delay(attempt, err)
+		withFields(fieldOperation, operation).info(2, "Retrying failed request",
+			"attempt", attempt, "max_attempts", r.policy.maxAttempts, "delay", delay, fieldRequestID, requestID(responseOf(err)), fieldError, err)
+		if !r.sleep(delay, ctx.Done()) {
+			return err
+		}
+	}
+}
+
+// withTimeout bounds ctx by the request timeout unless it has a deadline already
+func (r *retryAPI) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || r.policy.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.policy.timeout)
+}
+
+// ListZones lists the zones, retrying transient failures
+func (r *retryAPI) ListZones() (dns.ZoneListResult, error) {
+	return r.ListZonesWithContext(context.Background())
+}
+
+// ListZonesWithContext lists the zones, retrying transient failures until ctx is done
+func (r *retryAPI) ListZonesWithContext(ctx context.Context) (result dns.ZoneListResult, err error) {
+	err = r.do(ctx, "ListZones", func(ctx context.Context) error {
+		result, err = r.api.ListZonesWithContext(ctx)
+		return err
+	})
+	return result, err
+}
+
+// CreateOrUpdateZone creates or updates a zone, retrying transient failures
+func (r *retryAPI) CreateOrUpdateZone(zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error) {
+	return r.CreateOrUpdateZoneWithContext(context.Background(), zoneName, zone, ifMatch, ifNoneMatch)
+}
+
+// CreateOrUpdateZoneWithContext creates or updates a zone, retrying transient failures until ctx is done
+func (r *retryAPI) CreateOrUpdateZoneWithContext(ctx context.Context, zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (result dns.Zone, err error) {
+	err = r.do(ctx, "CreateOrUpdateZone", func(ctx context.Context) error {
+		result, err = r.api.CreateOrUpdateZoneWithContext(ctx, zoneName, zone, ifMatch, ifNoneMatch)
+		return err
+	})
+	return result, err
+}
+
+// DeleteZone deletes a zone, retrying transient failures until cancel is closed
+func (r *retryAPI) DeleteZone(zoneName string, ifMatch string, cancel <-chan struct{}) (<-chan dns.ZoneDeleteResult, <-chan error) {
+	return deleteZoneAsync(cancel, func(ctx context.Context) (dns.ZoneDeleteResult, error) {
+		return r.DeleteZoneWithContext(ctx, zoneName, ifMatch)
+	})
+}
+
+// DeleteZoneWithContext deletes a zone, retrying transient failures until ctx is done
+func (r *retryAPI) DeleteZoneWithContext(ctx context.Context, zoneName string, ifMatch string) (result dns.ZoneDeleteResult, err error) {
+	err = r.do(ctx, "DeleteZone", func(ctx context.Context) error {
+		result, err = r.api.DeleteZoneWithContext(ctx, zoneName, ifMatch)
+		return err
+	})
+	return result, err
+}
+
+// ListResourceRecordSetsByZone lists the record sets of a zone, retrying transient failures
+func (r *retryAPI) ListResourceRecordSetsByZone(zoneName string) (*[]dns.RecordSet, error) {
+	return r.ListResourceRecordSetsByZoneWithContext(context.Background(), zoneName)
+}
+
+// ListResourceRecordSetsByZoneWithContext lists the record sets of a zone, retrying transient failures until ctx is done
+func (r *retryAPI) ListResourceRecordSetsByZoneWithContext(ctx context.Context, zoneName string) (result *[]dns.RecordSet, err error) {
+	err = r.do(ctx, "ListResourceRecordSetsByZone", func(ctx context.Context) error {
+		result, err = r.api.ListResourceRecordSetsByZoneWithContext(ctx, zoneName)
+		return err
+	})
+	return result, err
+}
+
+// CreateOrUpdateRecordSet creates or updates a record set, retrying transient failures
+func (r *retryAPI) CreateOrUpdateRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error) {
+	return r.CreateOrUpdateRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+}
+
+// CreateOrUpdateRecordSetWithContext creates or updates a record set, retrying transient failures until ctx is done.
+// A failed attempt may still have been committed, e.g. behind a 504 from the gateway,
+// so a retried conditional create (If-None-Match: *) rejected with 412 succeeds
+// when the existing record set equals the requested one.
+func (r *retryAPI) CreateOrUpdateRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (result dns.RecordSet, err error) {
+	retried := false
+	err = r.do(ctx, "CreateOrUpdateRecordSet", func(ctx context.Context) error {
+		result, err = r.api.CreateOrUpdateRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+		if retried && ifNoneMatch == "*" && isPreconditionFailed(err) {
+			if existing, getErr := r.api.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType); getErr == nil && recordSetsEqual(existing, parameters) {
+				withFields(fieldZone, zoneName, fieldName, relativeRecordSetName, fieldType, string(recordType)).
+					info(2, "Record set created by an earlier attempt")
+				result, err = existing, nil
+			}
+		}
+		retried = true
+		return err
+	})
+	return result, err
+}
+
+// DeleteRecordSet deletes a record set, retrying transient failures
+func (r *retryAPI) DeleteRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (autorest.Response, error) {
+	return r.DeleteRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType, ifMatch)
+}
+
+// DeleteRecordSetWithContext deletes a record set, retrying transient failures until ctx is done
+func (r *retryAPI) DeleteRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (result autorest.Response, err error) {
+	err = r.do(ctx, "DeleteRecordSet", func(ctx context.Context) error {
+		result, err = r.api.DeleteRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType, ifMatch)
+		return err
+	})
+	return result, err
+}
+
+// GetRecordSet returns a record set, retrying transient failures
+func (r *retryAPI) GetRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	return r.GetRecordSetWithContext(context.Background(), zoneName, relativeRecordSetName, recordType)
+}
+
+// GetRecordSetWithContext returns a record set, retrying transient failures until ctx is done
+func (r *retryAPI) GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (result dns.RecordSet, err error) {
+	err = r.do(ctx, "GetRecordSet", func(ctx context.Context) error {
+		result, err = r.api.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType)
+		return err
+	})
+	return result, err
+}
+
+// ListRecordSetsByName returns the record sets of a name, retrying transient failures
+func (r *retryAPI) ListRecordSetsByName(zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	return r.ListRecordSetsByNameWithContext(context.Background(), zoneName, relativeRecordSetName, recordTypes)
+}
+
+// ListRecordSetsByNameWithContext returns the record sets of a name, retrying transient failures until ctx is done.
+// Each type is looked up and retried on its own, so a transient failure doesn't refetch the other types.
+func (r *retryAPI) ListRecordSetsByNameWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rrsets := make([]dns.RecordSet, 0)
+	for _, recordType := range recordTypes {
+		rset, err := r.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rrsets = append(rrsets, rset)
+	}
+	return &rrsets, nil
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
+)
+
+// faultAPI wraps the mock API and fails calls with the queued errors
+// before passing them to the mock
+type faultAPI struct {
+	azurestub.API
+	faults []error
+	calls  int
+}
+
+func (f *faultAPI) fault() error {
+	f.calls++
+	if len(f.faults) == 0 {
+		return nil
+	}
+	err := f.faults[0]
+	f.faults = f.faults[1:]
+	return err
+}
+
+func (f *faultAPI) ListZonesWithContext(ctx context.Context) (dns.ZoneListResult, error) {
+	if err := f.fault(); err != nil {
+		return dns.ZoneListResult{}, err
+	}
+	return f.API.ListZonesWithContext(ctx)
+}
+
+func (f *faultAPI) CreateOrUpdateRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error) {
+	if err := f.fault(); err != nil {
+		return dns.RecordSet{}, err
+	}
+	return f.API.CreateOrUpdateRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+}
+
+func (f *faultAPI) GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	if err := f.fault(); err != nil {
+		return dns.RecordSet{}, err
+	}
+	return f.API.GetRecordSetWithContext(ctx, zoneName, relativeRecordSetName, recordType)
+}
+
+func (f *faultAPI) DeleteZoneWithContext(ctx context.Context, zoneName string, ifMatch string) (dns.ZoneDeleteResult, error) {
+	if err := f.fault(); err != nil {
+		return dns.ZoneDeleteResult{}, err
+	}
+	return f.API.DeleteZoneWithContext(ctx, zoneName, ifMatch)
+}
+
+// httpError returns an Azure error for the HTTP status code
+func httpError(statusCode int, retryAfter string) error {
+	resp := &http.Response{StatusCode: statusCode, Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return autorest.NewErrorWithError(fmt.Errorf("status %d", statusCode), "dns.ZonesClient", "List", resp, "Failure responding to request")
+}
+
+// newTestRetryAPI returns a retrying API over the faults which records its delays
+func newTestRetryAPI(faults ...error) (*retryAPI, *faultAPI, *[]time.Duration) {
+	api := &faultAPI{API: azurestub.NewAPIStub(), faults: faults}
+	var delays []time.Duration
+
+	r := newRetryAPI(api, newRetryPolicy(Config{}))
+	r.sleep = func(delay time.Duration, cancel <-chan struct{}) bool {
+		delays = append(delays, delay)
+		return true
+	}
+	return r, api, &delays
+}
+
+/* TestRetryTransientErrors verifies that throttling and server errors are retried with backoff */
+func TestRetryTransientErrors(t *testing.T) {
+	r, api, delays := newTestRetryAPI(httpError(429, "7"), httpError(503, ""), httpError(500, ""))
+
+	if _, err := r.ListZones(); err != nil {
+		t.Fatalf("Unexpected error after retries: %v", err)
+	}
+	if api.calls != 4 {
+		t.Errorf("Got %d calls, expected 4", api.calls)
+	}
+
+	if len(*delays) != 3 {
+		t.Fatalf("Got delays %v, expected 3", *delays)
+	}
+	if (*delays)[0] != 7*time.Second {
+		t.Errorf("Got delay %v, expected the Retry-After of 7s", (*delays)[0])
+	}
+	if d := (*delays)[1]; d < 1600*time.Millisecond || d > 2*time.Second {
+		t.Errorf("Got delay %v for the second retry, expected 1.6s to 2s", d)
+	}
+	if d := (*delays)[2]; d < 3200*time.Millisecond || d > 4*time.Second {
+		t.Errorf("Got delay %v for the third retry, expected 3.2s to 4s", d)
+	}
+}
+
+/* TestRetryAfterCapped verifies that a Retry-After beyond the maximum delay is capped */
+func TestRetryAfterCapped(t *testing.T) {
+	r, _, delays := newTestRetryAPI(httpError(429, "3600"))
+
+	if _, err := r.ListZones(); err != nil {
+		t.Fatalf("Unexpected error after retry: %v", err)
+	}
+	if len(*delays) != 1 || (*delays)[0] != defaultRetryMaxDelay {
+		t.Errorf("Got delays %v, expected the maximum delay of %v", *delays, defaultRetryMaxDelay)
+	}
+}
+
+/* TestRetryPermanentErrors verifies that client errors are not retried */
+func TestRetryPermanentErrors(t *testing.T) {
+	for _, fault := range []error{httpError(400, ""), httpError(404, ""), fmt.Errorf("Etag doesn't allow update")} {
+		r, api, _ := newTestRetryAPI(fault)
+
+		_, err := r.CreateOrUpdateRecordSet("test.com", "www", dns.A, dns.RecordSet{}, "", "")
+		if err == nil || err.Error() != fault.Error() {
+			t.Errorf("Got error %v, expected %v", err, fault)
+		}
+		if api.calls != 1 {
+			t.Errorf("Got %d calls for %v, expected 1", api.calls, fault)
+		}
+	}
+}
+
+/* TestRetryRequestFailures verifies that only transport failures without a response are retried */
+func TestRetryRequestFailures(t *testing.T) {
+	sendError := func(err error) error {
+		return autorest.NewErrorWithError(&url.Error{Op: "Get", URL: "https://management.azure.com", Err: err}, "dns.ZonesClient", "List", nil, sendFailure)
+	}
+	for _, test := range []struct {
+		err       error
+		retriable bool
+	}{
+		{sendError(errors.New("connection reset by peer")), true},
+		{sendError(context.Canceled), false},
+		{sendError(context.DeadlineExceeded), false},
+		{autorest.NewErrorWithError(errors.New("invalid URL"), "dns.ZonesClient", "List", nil, "Failure preparing request"), false},
+		{errors.New("rate: Wait(n=1) would exceed context deadline"), false},
+	} {
+		if got := isRetriable(test.err); got != test.retriable {
+			t.Errorf("Got retriable %t for %v, expected %t", got, test.err, test.retriable)
+		}
+	}
+}
+
+/* TestRetryAttemptsExhausted verifies that the last error is returned after the maximum attempts */
+func TestRetryAttemptsExhausted(t *testing.T) {
+	r, api, delays := newTestRetryAPI(httpError(500, ""), httpError(500, ""), httpError(500, ""), httpError(500, ""), httpError(500, ""), httpError(500, ""))
+	r.policy.maxDelay = 3 * time.Second
+
+	if _, err := r.ListZones(); err == nil {
+		t.Errorf("Expected an error after %d attempts", defaultRetryMaxAttempts)
+	}
+	if api.calls != defaultRetryMaxAttempts {
+		t.Errorf("Got %d calls, expected %d", api.calls, defaultRetryMaxAttempts)
+	}
+	for _, d := range *delays {
+		if d > 3*time.Second {
+			t.Errorf("Delay %v exceeds the maximum delay", d)
+		}
+	}
+}
+
+/* TestRetryDeleteZone verifies that asynchronous zone deletion is retried */
+func TestRetryDeleteZone(t *testing.T) {
+	r, api, _ := newTestRetryAPI(httpError(502, ""))
+
+	results, errs := r.DeleteZone("test.com", "", nil)
+	if err := <-errs; err != nil {
+		t.Errorf("Unexpected error after retry: %v", err)
+	}
+	if result := <-results; result.Status != "Succeeded" {
+		t.Errorf("Got status %q, expected Succeeded", result.Status)
+	}
+	if api.calls != 2 {
+		t.Errorf("Got %d calls, expected 2", api.calls)
+	}
+}
+
+/* TestRetryListRecordSetsByName verifies that each record type is retried on its own */
+func TestRetryListRecordSetsByName(t *testing.T) {
+	r, api, delays := newTestRetryAPI(httpError(503, ""))
+	api.API.CreateOrUpdateZone("test.com", dns.Zone{Name: to.StringPtr("test.com")}, "", "")
+	api.API.CreateOrUpdateRecordSet("test.com", "www", dns.A, testRecordSet("www"), "", "")
+
+	rrsets, err := r.ListRecordSetsByName("test.com", "www", supportedRecordTypes)
+	if err != nil {
+		t.Fatalf("Unexpected error after retries: %v", err)
+	}
+	if len(*rrsets) != 1 {
+		t.Errorf("Got %d record sets, expected the A record set", len(*rrsets))
+	}
+	if api.calls != len(supportedRecordTypes)+1 || len(*delays) != 1 {
+		t.Errorf("Got %d calls and delays %v, expected only the failed type to be retried", api.calls, *delays)
+	}
+}
+
+/* TestRetryConditionalCreate verifies that a retried create rejected with 412 succeeds if an earlier attempt committed it */
+func TestRetryConditionalCreate(t *testing.T) {
+	other := testRecordSet("www")
+	other.ARecords = &[]dns.ARecord{{Ipv4Address: to.StringPtr("10.0.0.2")}}
+	for _, test := range []struct {
+		committed dns.RecordSet
+		faults    []error
+		succeeds  bool
+	}{
+		// the first attempt committed the record set before failing with 504
+		{testRecordSet("www"), []error{httpError(504, "")}, true},
+		// a different record set exists
+		{other, []error{httpError(504, "")}, false},
+		// the record set existed before the first attempt
+		{testRecordSet("www"), nil, false},
+	} {
+		r, api, _ := newTestRetryAPI(test.faults...)
+		api.API.CreateOrUpdateZone("test.com", dns.Zone{Name: to.StringPtr("test.com")}, "", "")
+		api.API.CreateOrUpdateRecordSet("test.com", "www", dns.A, test.committed, "", "")
+
+		_, err := r.CreateOrUpdateRecordSetWithContext(context.Background(), "test.com", "www", dns.A, testRecordSet("www"), "", "*")
+		if test.succeeds && err != nil {
+			t.Errorf("Got error %v, expected the committed record set to be accepted", err)
+		}
+		if !test.succeeds && !isPreconditionFailed(err) {
+			t.Errorf("Got error %v, expected 412 Precondition Failed", err)
+		}
+	}
+}
@@ -17,10 +17,12 @@ limitations under the License.
 package azuredns
 
 import (
-	"strings"
+	"context"
+	"fmt"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
-	"github.com/golang/glog"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
 )
 
@@ -46,7 +48,7 @@ func (c *ResourceRecordChangeset) Add(rrset dnsprovider.ResourceRecordSet) dnspr
 	return c
 }
 
-//Remove adds a ResourceRecordSet to remove a DNS Resource Record
+// Remove adds a ResourceRecordSet to remove a DNS Resource Record
 func (c *ResourceRecordChangeset) Remove(rrset dnsprovider.ResourceRecordSet) dnsprovider.ResourceRecordChangeset {
 	c.removals = append(c.removals, rrset)
 	return c
@@ -60,21 +62,47 @@ func (c *ResourceRecordChangeset) Upsert(rrset dnsprovider.ResourceRecordSet) dn
 
 // Apply executes all the changes in the changeset
 func (c *ResourceRecordChangeset) Apply() error {
+	return c.ApplyWithContext(context.Background())
+}
+
+// ApplyWithContext executes all the changes in the changeset and
+// stops at the first request failing because ctx is done
+func (c *ResourceRecordChangeset) ApplyWithContext(ctx context.Context) (err error) {
+	ctx = withResourceGroup(ctx, c.zone.ResourceGroup())
+	c.zone.zones.impl.metrics.setChangesetSize(c.zone.Name(), len(c.removals), len(c.upserts), len(c.additions))
+
+	ctx, span := c.zone.zones.impl.tracing.start(ctx, "azuredns.Apply",
+		attrZone.String(c.zone.Name()),
+		attrRemovals.Int(len(c.removals)),
+		attrUpserts.Int(len(c.upserts)),
+		attrAdditions.Int(len(c.additions)))
+	defer func() { endSpan(span, err) }()
+
+	// fail before making any change
+	if err := c.validate(); err != nil {
+		return err
+	}
 
 	zoneName := c.zone.impl.Name
+	start := time.Now()
 	// since it looks like the autorest API is request/response we can
 	// start with calling the REST APIs one-by-one
-	svc := c.rrsets.zone.zones.impl.service
+	svc := c.rrsets.zone.service()
 
 	for _, removal := range c.removals {
 		var rset = removal.(ResourceRecordSet).toRecordSet()
 
 		recType := rset.Type
 
-		glog.V(4).Infof("azuredns: Delete:\tRecordSet: %q Type: %q Zone Name: %s TTL: %i ID %q \n", *rset.Name, *recType, *zoneName, *rset.RecordSetProperties.TTL, *rset.ID)
-		_, err := svc.DeleteRecordSet(*zoneName, *rset.Name, dns.RecordType(*recType), "")
+		log := withFields(recordSetFields(*zoneName, rset)...).with(fieldOperation, "remove")
+		log.info(4, "Applying change")
+		changeCtx, changeSpan := c.startChange(ctx, "azuredns.Remove", rset)
+		before := c.currentState(changeCtx, rset)
+		_, err := svc.DeleteRecordSetWithContext(changeCtx, *zoneName, *rset.Name, dns.RecordType(*recType), "")
+		endSpan(changeSpan, err)
+		c.audit(AuditRemoveRecordSet, before, nil, err)
 		if err != nil {
-			glog.V(1).Infof("azuredns: Could not delete DNS %s", *rset.Name)
+			log.error("Could not apply change", err)
 			return err
 		}
 	}
@@ -83,12 +111,19 @@ func (c *ResourceRecordChangeset) Apply() error {
 		var rset = upsert.(ResourceRecordSet).toRecordSet()
 
 		recType := rset.Type
-		glog.V(4).Infof("azuredns: Upsert:\tRecordSet: %s Type: %s Zone Name: %s TTL: %i \n", *rset.Name, *recType, *zoneName, *rset.RecordSetProperties.TTL)
+		log := withFields(recordSetFields(*zoneName, rset)...).with(fieldOperation, "upsert")
+		log.info(4, "Applying change", fieldRrdatas, upsert.Rrdatas())
 
-		_, err := svc.CreateOrUpdateRecordSet(*zoneName, *rset.Name, dns.RecordType(*recType), *rset, "", "*")
+		changeCtx, changeSpan := c.startChange(ctx, "azuredns.Upsert", rset)
+		before := c.currentState(changeCtx, rset)
+		// an upsert replaces an existing record set, If-None-Match: * would
+		// make ARM reject it with 412 Precondition Failed
+		_, err := svc.CreateOrUpdateRecordSetWithContext(changeCtx, *zoneName, *rset.Name, dns.RecordType(*recType), *rset, "", "")
+		endSpan(changeSpan, err)
+		c.audit(AuditUpsertRecordSet, before, upsert, err)
 
 		if err != nil {
-			glog.V(0).Infof("azuredns: Could not upsert DNS %s", upsert.Name)
+			log.error("Could not apply change", err)
 			return err
 		}
 	}
@@ -97,36 +132,73 @@ func (c *ResourceRecordChangeset) Apply() error {
 		var rset = addition.(ResourceRecordSet).toRecordSet()
 		recType := rset.Type
 
-		glog.V(4).Infof("azuredns:  Addition:\tRecordSet: %s Type: %s Zone Name: %s TTL: %i \n", *rset.Name, *recType, *zoneName, *rset.RecordSetProperties.TTL)
+		log := withFields(recordSetFields(*zoneName, rset)...).with(fieldOperation, "add")
+		log.info(4, "Applying change", fieldRrdatas, addition.Rrdatas())
 
-		props := rset.RecordSetProperties
-
-		if glog.V(5) {
-			switch strings.TrimPrefix(*recType, "Microsoft.Network/dnszones/") {
-			case "A":
-				for i := range *props.ARecords {
-					rec := *props.ARecords
-					glog.V(0).Infof("azuredns: A Rec Ipv4: %s\n", *rec[i].Ipv4Address)
-				}
+		changeCtx, changeSpan := c.startChange(ctx, "azuredns.Add", rset)
+		before := c.currentState(changeCtx, rset)
+		_, err := svc.CreateOrUpdateRecordSetWithContext(changeCtx, *zoneName, *rset.Name, dns.RecordType(*recType), *rset, "", "*")
+		endSpan(changeSpan, err)
+		c.audit(AuditAddRecordSet, before, addition, err)
+		if err != nil {
+			log.error("Could not apply change", err)
+			return err
+		}
+	}
 
-			case "AAAA":
-				for i := range *props.AaaaRecords {
-					rec := *props.AaaaRecords
-					glog.V(0).Infof("azuredns: AAAA Rec Ipv6: %s\n", *rec[i].Ipv6Address)
-				}
+	withFields(fieldZone, *zoneName, fieldDuration, time.Since(start)).
+		info(4, "Applied changeset", "removals", len(c.removals), "upserts", len(c.upserts), "additions", len(c.additions))
+	return nil
+}
 
-			case "CNAME":
-				glog.V(5).Infof("azuredns: CNAME: %s for name: %s, ID: %s, TTL %i\n", *props.CnameRecord.Cname, *rset.Name, *rset.ID, *rset.RecordSetProperties.TTL)
+// validate returns the error of the first record set in the changeset whose
+// rrdatas couldn't be converted
+func (c *ResourceRecordChangeset) validate() error {
+	for _, changes := range [][]dnsprovider.ResourceRecordSet{c.removals, c.upserts, c.additions} {
+		for _, change := range changes {
+			if rrset := change.(ResourceRecordSet); rrset.err != nil {
+				return fmt.Errorf("record set %s: %w", rrset.Name(), rrset.err)
 			}
 		}
-		_, err := svc.CreateOrUpdateRecordSet(*zoneName, *rset.Name, dns.RecordType(*recType), *rset, "", "*")
-		if err != nil {
-			glog.V(0).Infof("azuredns: Could not add DNS %s type %s: %s", addition.Name(), *recType, err.Error())
-			return err
+	}
+	return nil
+}
+
+// startChange opens the span of a single change of the changeset
+func (c *ResourceRecordChangeset) startChange(ctx context.Context, name string, rset *dns.RecordSet) (context.Context, trace.Span) {
+	return c.zone.zones.impl.tracing.start(ctx, name,
+		attrZone.String(c.zone.Name()),
+		attrRecordName.String(*rset.Name),
+		attrRecordType.String(*rset.Type))
+}
+
+// currentState returns the record set rset replaces, removes or collides
+// with, nil if it doesn't exist or if auditing is disabled. It is read past
+// the cache so that the audit log shows the actual state in Azure.
+func (c *ResourceRecordChangeset) currentState(ctx context.Context, rset *dns.RecordSet) dnsprovider.ResourceRecordSet {
+	if !c.zone.zones.impl.audit.enabled() {
+		return nil
+	}
+	current, err := uncached(c.zone.service()).GetRecordSetWithContext(ctx, c.zone.Name(), *rset.Name, dns.RecordType(*rset.Type))
+	if err != nil {
+		if !isNotFound(err) {
+			withFields(recordSetFields(c.zone.Name(), rset)...).error("Could not look up the record set for the audit log", err)
 		}
+		return nil
 	}
+	return ResourceRecordSet{impl: &current, rrsets: c.rrsets}
+}
 
-	return nil
+// audit records a change of the changeset with the audit sink of the interface
+func (c *ResourceRecordChangeset) audit(operation string, before, after dnsprovider.ResourceRecordSet, err error) {
+	impl := c.zone.zones.impl
+	if !impl.audit.enabled() {
+		return
+	}
+	event := impl.auditEvent(c.zone.service(), operation, c.zone.Name())
+	event.Before = newAuditRecordSet(before)
+	event.After = newAuditRecordSet(after)
+	impl.audit.record(event, err)
 }
 
 // IsEmpty checks for an empty changeset
@@ -0,0 +1,216 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// maxTxtChunk is the length limit in bytes of a DNS character-string
+const maxTxtChunk = 255
+
+// parseTxt returns the text of a TXT rrdata. The rrdata is either the text
+// itself or one or more quoted character-strings, which are joined. Quoted
+// strings may contain \" and \\ escapes and \DDD decimal byte escapes.
+func parseTxt(rrdata string) (string, error) {
+	s := strings.TrimSpace(rrdata)
+	if !strings.HasPrefix(s, `"`) {
+		return rrdata, nil
+	}
+
+	var b bytes.Buffer
+	for s != "" {
+		if s[0] != '"' {
+			return "", fmt.Errorf("%w: TXT %q: text outside of quotes", ErrInvalidRecord, rrdata)
+		}
+		i, closed := 1, false
+		for i < len(s) && !closed {
+			switch c := s[i]; {
+			case c == '"':
+				closed = true
+				i++
+			case c == '\\' && i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]):
+				n := int(s[i+1]-'0')*100 + int(s[i+2]-'0')*10 + int(s[i+3]-'0')
+				if n > 255 {
+					return "", fmt.Errorf("%w: TXT %q: escape \\%s out of range", ErrInvalidRecord, rrdata, s[i+1:i+4])
+				}
+				b.WriteByte(byte(n))
+				i += 4
+			case c == '\\' && i+1 < len(s):
+				b.WriteByte(s[i+1])
+				i += 2
+			default:
+				b.WriteByte(c)
+				i++
+			}
+		}
+		if !closed {
+			return "", fmt.Errorf("%w: TXT %q: unterminated quote", ErrInvalidRecord, rrdata)
+		}
+		s = strings.TrimLeft(s[i:], " \t")
+	}
+	return b.String(), nil
+}
+
+// splitTxt splits text into character-strings of at most 255 bytes,
+// keeping UTF-8 sequences in one piece
+func splitTxt(text string) []string {
+	chunks := make([]string, 0, len(text)/maxTxtChunk+1)
+	for len(text) > maxTxtChunk {
+		cut := maxTxtChunk
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = maxTxtChunk
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	return append(chunks, text)
+}
+
+// formatTxt joins the character-strings of a TXT record into a single
+// rrdata that parseTxt reads back unchanged. The text is returned as is,
+// so that plain rrdatas read back like they were written, unless it is
+// empty or starts with a quote; then it is quoted.
+func formatTxt(chunks []string) string {
+	text := strings.Join(chunks, "")
+	if text != "" && !strings.HasPrefix(strings.TrimSpace(text), `"`) {
+		return text
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for _, chunk := range chunks {
+		for i := 0; i < len(chunk); i++ {
+			switch c := chunk[i]; {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c < ' ' || c == 0x7f:
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// parseMx converts an MX rrdata like "10 mail.example.com." to a record
+func parseMx(rrdata string) (dns.MxRecord, error) {
+	fields := strings.Fields(rrdata)
+	if len(fields) != 2 {
+		return dns.MxRecord{}, fmt.Errorf("%w: MX %q: expected \"preference exchange\"", ErrInvalidRecord, rrdata)
+	}
+	preference, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return dns.MxRecord{}, fmt.Errorf("%w: MX %q: preference must be a number from 0 to 65535", ErrInvalidRecord, rrdata)
+	}
+	return dns.MxRecord{
+		Preference: to.Int32Ptr(int32(preference)),
+		Exchange:   to.StringPtr(fields[1]),
+	}, nil
+}
+
+// formatMx returns the rrdata of an MX record
+func formatMx(rec dns.MxRecord) string {
+	return fmt.Sprintf("%d %s", to.Int32(rec.Preference), to.String(rec.Exchange))
+}
+
+// parseSrv converts an SRV rrdata like "10 5 5060 sip.example.com." to a
+// record, normalizing the target with normalizeFqdn
+func parseSrv(rrdata string) (dns.SrvRecord, error) {
+	fields := strings.Fields(rrdata)
+	if len(fields) != 4 {
+		return dns.SrvRecord{}, fmt.Errorf("%w: SRV %q: expected \"priority weight port target\"", ErrInvalidRecord, rrdata)
+	}
+	var values [3]int32
+	for i, field := range []string{"priority", "weight", "port"} {
+		value, err := strconv.ParseUint(fields[i], 10, 16)
+		if err != nil {
+			return dns.SrvRecord{}, fmt.Errorf("%w: SRV %q: %s must be a number from 0 to 65535", ErrInvalidRecord, rrdata, field)
+		}
+		values[i] = int32(value)
+	}
+	target, err := normalizeFqdn(fields[3])
+	if err != nil {
+		return dns.SrvRecord{}, fmt.Errorf("%w: SRV %q: target %v", ErrInvalidRecord, rrdata, err)
+	}
+	return dns.SrvRecord{
+		Priority: to.Int32Ptr(values[0]),
+		Weight:   to.Int32Ptr(values[1]),
+		Port:     to.Int32Ptr(values[2]),
+		Target:   to.StringPtr(target),
+	}, nil
+}
+
+// formatSrv returns the rrdata of an SRV record
+func formatSrv(rec dns.SrvRecord) string {
+	return fmt.Sprintf("%d %d %d %s", to.Int32(rec.Priority), to.Int32(rec.Weight), to.Int32(rec.Port), to.String(rec.Target))
+}
+
+// normalizeFqdn returns name in lower case with a trailing dot and checks
+// the lengths of its labels. The root "." is returned as is.
+func normalizeFqdn(name string) (string, error) {
+	if name == "." {
+		return name, nil
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" || len(name) > 253 {
+		return "", fmt.Errorf("%q is not a domain name", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("%q has an empty or too long label", name)
+		}
+	}
+	return name + ".", nil
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of an IP address
+func reverseName(addr string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return "", fmt.Errorf("%w: %q is not an IP address", ErrInvalidRecord, addr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+
+	// one label per nibble, least significant first
+	var b bytes.Buffer
+	for i := len(ip) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip[i]&0xf, ip[i]>>4)
+	}
+	b.WriteString("ip6.arpa")
+	return b.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+/* TestTxtRrdatas verifies the conversion of TXT rrdatas to character-strings and back */
+func TestTxtRrdatas(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		rrdata string
+		chunks []string
+		read   string
+	}{
+		{"v=spf1 -all", []string{"v=spf1 -all"}, "v=spf1 -all"},
+		{`"v=spf1 -all"`, []string{"v=spf1 -all"}, "v=spf1 -all"},
+		{`"say \"hi\"" " and \\ bye"`, []string{`say "hi" and \ bye`}, `say "hi" and \ bye`},
+		{`"tab\009"`, []string{"tab\t"}, "tab\t"},
+		{`""`, []string{""}, `""`},
+		// text starting with a quote is read back quoted
+		{`"\"quoted\""`, []string{`"quoted"`}, `"\"quoted\""`},
+		{long, []string{long[:255], long[255:]}, long},
+		// a 2-byte rune straddling the limit moves to the next string
+		{strings.Repeat("a", 254) + "é", []string{strings.Repeat("a", 254), "é"}, strings.Repeat("a", 254) + "é"},
+	}
+
+	for _, test := range tests {
+		rs := &dns.RecordSet{Type: to.StringPtr("TXT")}
+		if err := addRrDatasToRecordSet(rs, []string{test.rrdata}); err != nil {
+			t.Errorf("Failed to convert %q: %v", test.rrdata, err)
+			continue
+		}
+		if chunks := *(*rs.TxtRecords)[0].Value; !reflect.DeepEqual(chunks, test.chunks) {
+			t.Errorf("Got character-strings %q for %q, expected %q", chunks, test.rrdata, test.chunks)
+		}
+		read := ResourceRecordSet{impl: rs}.Rrdatas()
+		if !reflect.DeepEqual(read, []string{test.read}) {
+			t.Errorf("Read %q for %q, expected %q", read, test.rrdata, test.read)
+		}
+		// the rrdatas read convert to the same records
+		again := &dns.RecordSet{Type: to.StringPtr("TXT")}
+		if err := addRrDatasToRecordSet(again, read); err != nil || !reflect.DeepEqual(again.TxtRecords, rs.TxtRecords) {
+			t.Errorf("Rrdatas %q of %q don't round-trip: %v", read, test.rrdata, err)
+		}
+	}
+}
+
+/* TestTxtRrdatasInvalid verifies that malformed quoted TXT rrdatas are rejected */
+func TestTxtRrdatasInvalid(t *testing.T) {
+	for _, rrdata := range []string{`"unterminated`, `"a" b`, `"\256"`} {
+		rs := &dns.RecordSet{Type: to.StringPtr("TXT")}
+		if err := addRrDatasToRecordSet(rs, []string{rrdata}); !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("Got error %v for %q, expected ErrInvalidRecord", err, rrdata)
+		}
+	}
+}
+
+/* TestMxRrdatas verifies the conversion of MX rrdatas to records and back */
+func TestMxRrdatas(t *testing.T) {
+	rs := &dns.RecordSet{Type: to.StringPtr("MX")}
+	if err := addRrDatasToRecordSet(rs, []string{"10 mail.example.com.", " 20   backup.example.com. "}); err != nil {
+		t.Fatalf("Failed to convert MX rrdatas: %v", err)
+	}
+	want := []dns.MxRecord{
+		{Preference: to.Int32Ptr(10), Exchange: to.StringPtr("mail.example.com.")},
+		{Preference: to.Int32Ptr(20), Exchange: to.StringPtr("backup.example.com.")},
+	}
+	if !reflect.DeepEqual(*rs.MxRecords, want) {
+		t.Errorf("Got records %+v, expected %+v", *rs.MxRecords, want)
+	}
+	read := ResourceRecordSet{impl: rs}.Rrdatas()
+	if want := []string{"10 mail.example.com.", "20 backup.example.com."}; !reflect.DeepEqual(read, want) {
+		t.Errorf("Read %q, expected %q", read, want)
+	}
+
+	for _, rrdata := range []string{"mail.example.com.", "ten mail.example.com.", "-1 mail.example.com.", "65536 mail.example.com.", "10 mail example.com."} {
+		rs := &dns.RecordSet{Type: to.StringPtr("MX")}
+		if err := addRrDatasToRecordSet(rs, []string{rrdata}); !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("Got error %v for %q, expected ErrInvalidRecord", err, rrdata)
+		}
+	}
+}
+
+/* TestSrvRrdatas verifies the conversion of SRV rrdatas to records and back */
+func TestSrvRrdatas(t *testing.T) {
+	rs := &dns.RecordSet{Type: to.StringPtr("SRV")}
+	if err := addRrDatasToRecordSet(rs, []string{"10 5 5060 SIP.example.com", "0 0 0 ."}); err != nil {
+		t.Fatalf("Failed to convert SRV rrdatas: %v", err)
+	}
+	want := dns.SrvRecord{Priority: to.Int32Ptr(10), Weight: to.Int32Ptr(5), Port: to.Int32Ptr(5060), Target: to.StringPtr("sip.example.com.")}
+	if got := (*rs.SrvRecords)[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got record %+v, expected %+v", got, want)
+	}
+	read := ResourceRecordSet{impl: rs}.Rrdatas()
+	if want := []string{"10 5 5060 sip.example.com.", "0 0 0 ."}; !reflect.DeepEqual(read, want) {
+		t.Errorf("Read %q, expected %q", read, want)
+	}
+
+	for _, rrdata := range []string{
+		"10 5 sip.example.com.",
+		"10 5 65536 sip.example.com.",
+		"10 -5 5060 sip.example.com.",
+		"10 70000 5060 sip.example.com.",
+		"10 5 5060 sip..example.com.",
+		"10 5 5060 " + strings.Repeat("a", 64) + ".example.com.",
+	} {
+		rs := &dns.RecordSet{Type: to.StringPtr("SRV")}
+		if err := addRrDatasToRecordSet(rs, []string{rrdata}); !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("Got error %v for %q, expected ErrInvalidRecord", err, rrdata)
+		}
+	}
+}
+
+/* TestNsRrdatas verifies that NS rrdatas are normalized and validated */
+func TestNsRrdatas(t *testing.T) {
+	rs := &dns.RecordSet{Type: to.StringPtr("NS")}
+	if err := addRrDatasToRecordSet(rs, []string{"NS1-01.azure-dns.com", "ns2-01.azure-dns.net."}); err != nil {
+		t.Fatalf("Failed to convert NS rrdatas: %v", err)
+	}
+	read := ResourceRecordSet{impl: rs}.Rrdatas()
+	if want := []string{"ns1-01.azure-dns.com.", "ns2-01.azure-dns.net."}; !reflect.DeepEqual(read, want) {
+		t.Errorf("Read %q, expected %q", read, want)
+	}
+
+	rs = &dns.RecordSet{Type: to.StringPtr("NS")}
+	if err := addRrDatasToRecordSet(rs, []string{"ns1..azure-dns.com."}); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("Got error %v for an empty label, expected ErrInvalidRecord", err)
+	}
+}
+
+/* TestReverseName verifies the reverse lookup names of IPv4 and IPv6 addresses */
+func TestReverseName(t *testing.T) {
+	tests := map[string]string{
+		"10.0.1.2":    "2.1.0.10.in-addr.arpa",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+	}
+	for addr, want := range tests {
+		if got, err := reverseName(addr); err != nil || got != want {
+			t.Errorf("Got %q (%v) for %s, expected %q", got, err, addr, want)
+		}
+	}
+	if _, err := reverseName("not-an-ip"); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("Got error %v for an invalid address, expected ErrInvalidRecord", err)
+	}
+}
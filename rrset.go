@@ -17,11 +17,13 @@ limitations under the License.
 package azuredns
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
 	"github.com/Azure/go-autorest/autorest/to"
-	"github.com/golang/glog"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider/rrstype"
 )
@@ -36,6 +38,9 @@ var _ dnsprovider.ResourceRecordSet = ResourceRecordSet{}
 type ResourceRecordSet struct {
 	impl   *dns.RecordSet
 	rrsets *ResourceRecordSets
+	// err is the error converting the rrdatas passed to ResourceRecordSets.New,
+	// returned by Apply
+	err error
 }
 
 // Name returns the absolute ResourceRecordSet name, i.e. the name includes the zone
@@ -49,6 +54,14 @@ func (rrset ResourceRecordSet) Name() string {
 	return *rrset.impl.Name + "." + rrset.rrsets.zone.Name()
 }
 
+// fqdn returns the absolute name of rrset, the zone name for the zone apex
+func fqdn(rrset dnsprovider.ResourceRecordSet) string {
+	if r, ok := rrset.(ResourceRecordSet); ok && r.Name() == "@" && r.rrsets != nil {
+		return r.rrsets.zone.Name()
+	}
+	return rrset.Name()
+}
+
 // Rrdatas returns the record set details in string[] format.
 func (rrset ResourceRecordSet) Rrdatas() []string {
 	return rrset.getRrDatas()
@@ -67,7 +80,27 @@ func (rrset ResourceRecordSet) Ttl() int64 {
 func (rrset ResourceRecordSet) Type() rrstype.RrsType {
 	// Azure DNS API prefixes the type with Microsoft.Network/dnszones/.
 	// k8s expects only the DNS record type
-	return rrstype.RrsType(strings.TrimPrefix(*rrset.impl.Type, "Microsoft.Network/dnszones/"))
+	return rrstype.RrsType(recordTypeOf(*rrset.impl.Type))
+}
+
+// recordTypeOf returns the DNS record type of an Azure record set type
+// like Microsoft.Network/dnszones/A
+func recordTypeOf(azureType string) dns.RecordType {
+	return dns.RecordType(strings.TrimPrefix(azureType, "Microsoft.Network/dnszones/"))
+}
+
+// recordSetsEqual reports whether two record sets of the provider's record
+// types have the same type, TTL and rrdatas
+func recordSetsEqual(a, b dns.RecordSet) bool {
+	if a.Type == nil || b.Type == nil || recordTypeOf(*a.Type) != recordTypeOf(*b.Type) ||
+		a.RecordSetProperties == nil || b.RecordSetProperties == nil {
+		return false
+	}
+	rrsetA, rrsetB := ResourceRecordSet{impl: &a}, ResourceRecordSet{impl: &b}
+	rrdatasA, rrdatasB := rrsetA.Rrdatas(), rrsetB.Rrdatas()
+	sort.Strings(rrdatasA)
+	sort.Strings(rrdatasB)
+	return rrsetA.Ttl() == rrsetB.Ttl() && reflect.DeepEqual(rrdatasA, rrdatasB)
 }
 
 func (rrset ResourceRecordSet) toRecordSet() *dns.RecordSet {
@@ -81,8 +114,9 @@ func (rrset ResourceRecordSet) toRecordSet() *dns.RecordSet {
 		ID:   &nameCopy,
 	}
 
-	glog.V(5).Infof("New RecordSet: Name: %s ID: %s, Type: %s\n", *r.Name, *r.ID, *r.Type)
+	withFields(fieldName, r.Name, fieldType, r.Type).info(5, "Converting record set")
 
+	// the rrdatas of a record set are valid unless rrset.err is set
 	addRrDatasToRecordSet(r, rrset.Rrdatas())
 	r.RecordSetProperties.TTL = to.Int64Ptr(rrset.Ttl())
 	return r
@@ -113,13 +147,71 @@ func (rrset ResourceRecordSet) getRrDatas() []string {
 	case "CNAME":
 		rrDatas = make([]string, 1)
 		rrDatas[0] = *props.CnameRecord.Cname
+
+	case "TXT":
+		if props.TxtRecords == nil {
+			break
+		}
+		rrDatas = make([]string, len(*props.TxtRecords))
+
+		for i, rec := range *props.TxtRecords {
+			var chunks []string
+			if rec.Value != nil {
+				chunks = *rec.Value
+			}
+			// the character-strings of a record are joined, see formatTxt
+			rrDatas[i] = formatTxt(chunks)
+		}
+
+	case "MX":
+		if props.MxRecords == nil {
+			break
+		}
+		rrDatas = make([]string, len(*props.MxRecords))
+
+		for i, rec := range *props.MxRecords {
+			rrDatas[i] = formatMx(rec)
+		}
+
+	case "SRV":
+		if props.SrvRecords == nil {
+			break
+		}
+		rrDatas = make([]string, len(*props.SrvRecords))
+
+		for i, rec := range *props.SrvRecords {
+			rrDatas[i] = formatSrv(rec)
+		}
+
+	case "NS":
+		if props.NsRecords == nil {
+			break
+		}
+		rrDatas = make([]string, len(*props.NsRecords))
+
+		for i, rec := range *props.NsRecords {
+			rrDatas[i] = to.String(rec.Nsdname)
+		}
+
+	case "PTR":
+		if props.PtrRecords == nil {
+			break
+		}
+		rrDatas = make([]string, len(*props.PtrRecords))
+
+		for i, rec := range *props.PtrRecords {
+			rrDatas[i] = to.String(rec.Ptrdname)
+		}
 	}
 
 	return rrDatas
 }
 
-func addRrDatasToRecordSet(rs *dns.RecordSet, rrDatas []string) {
-	props := dns.RecordSetProperties{}
+// addRrDatasToRecordSet sets the records of rs from rrDatas. The records
+// converted before an invalid rrdata are set when an error is returned.
+func addRrDatasToRecordSet(rs *dns.RecordSet, rrDatas []string) error {
+	props := &dns.RecordSetProperties{}
+	rs.RecordSetProperties = props
 	var i int
 	rrsType := string(*rs.Type)
 	// kubernetes 1.6.2 only handles A, AAAA and CNAME
@@ -154,14 +246,71 @@ func addRrDatasToRecordSet(rs *dns.RecordSet, rrDatas []string) {
 				Cname: to.StringPtr(rrDatas[i]),
 			}
 		}
+
+	case "TXT":
+		recs := make([]dns.TxtRecord, 0, len(rrDatas))
+		props.TxtRecords = &recs
+		for i = range rrDatas {
+			text, err := parseTxt(rrDatas[i])
+			if err != nil {
+				return err
+			}
+			// values longer than a character-string are split, see splitTxt
+			chunks := splitTxt(text)
+			recs = append(recs, dns.TxtRecord{Value: &chunks})
+		}
+
+	case "MX":
+		recs := make([]dns.MxRecord, 0, len(rrDatas))
+		props.MxRecords = &recs
+		for i = range rrDatas {
+			rec, err := parseMx(rrDatas[i])
+			if err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+		}
+
+	case "SRV":
+		recs := make([]dns.SrvRecord, 0, len(rrDatas))
+		props.SrvRecords = &recs
+		for i = range rrDatas {
+			rec, err := parseSrv(rrDatas[i])
+			if err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+		}
+
+	case "NS":
+		recs := make([]dns.NsRecord, 0, len(rrDatas))
+		props.NsRecords = &recs
+		for i = range rrDatas {
+			nsdname, err := normalizeFqdn(strings.TrimSpace(rrDatas[i]))
+			if err != nil {
+				return fmt.Errorf("%w: NS %q: %v", ErrInvalidRecord, rrDatas[i], err)
+			}
+			recs = append(recs, dns.NsRecord{Nsdname: to.StringPtr(nsdname)})
+		}
+
+	case "PTR":
+		recs := make([]dns.PtrRecord, 0, len(rrDatas))
+		props.PtrRecords = &recs
+		for i = range rrDatas {
+			ptrdname, err := normalizeFqdn(strings.TrimSpace(rrDatas[i]))
+			if err != nil {
+				return fmt.Errorf("%w: PTR %q: %v", ErrInvalidRecord, rrDatas[i], err)
+			}
+			recs = append(recs, dns.PtrRecord{Ptrdname: to.StringPtr(ptrdname)})
+		}
 	}
 
-	rs.RecordSetProperties = &props
+	return nil
 }
 
 func (rrset ResourceRecordSet) setRecordSetProperties(ttl int64, rrDatas []string) dnsprovider.ResourceRecordSet {
 
-	addRrDatasToRecordSet(rrset.impl, rrDatas)
+	rrset.err = addRrDatasToRecordSet(rrset.impl, rrDatas)
 	rrset.impl.RecordSetProperties.TTL = to.Int64Ptr(ttl)
 
 	return rrset
@@ -20,7 +20,6 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
-	"github.com/golang/glog"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider/rrstype"
 )
@@ -28,6 +27,9 @@ import (
 // Compile time check for interface adherence
 var _ dnsprovider.ResourceRecordSets = ResourceRecordSets{}
 
+// supportedRecordTypes are the record types ResourceRecordSets.Get looks up
+var supportedRecordTypes = []dns.RecordType{dns.A, dns.AAAA, dns.CNAME, dns.TXT, dns.MX, dns.SRV, dns.NS, dns.PTR}
+
 // ResourceRecordSets struct point back to containing Zone.
 // It also allows navigation of the DNS hierarchy via ResourceRecordSet -> ResourceRecordSets -> Zone -> Zones
 type ResourceRecordSets struct {
@@ -37,9 +39,9 @@ type ResourceRecordSets struct {
 // List all resource record sets for this zone
 func (rrsets ResourceRecordSets) List() ([]dnsprovider.ResourceRecordSet, error) {
 
-	svc := rrsets.zone.zones.impl.service
+	svc := rrsets.zone.service()
 
-	rsets, err := svc.ListResourceRecordSetsByZone(rrsets.zone.Name())
+	rsets, err := svc.ListResourceRecordSetsByZoneWithContext(rrsets.zone.context(), rrsets.zone.Name())
 
 	if err != nil {
 		return nil, err
@@ -51,12 +53,8 @@ func (rrsets ResourceRecordSets) List() ([]dnsprovider.ResourceRecordSet, error)
 		// value is pointer to []RecordSet
 		r := *rsets
 		rs := r[i]
-		if &rs != nil {
-			glog.V(4).Infof("recordset data Name %s Type %s ID %s\n", *rs.Name, *rs.Type, *rs.ID)
-			list[i] = &ResourceRecordSet{&(r[i]), &rrsets}
-		} else {
-			glog.Fatalf("Recordset was nil\n")
-		}
+		withFields(recordSetFields(rrsets.zone.Name(), &rs)...).info(5, "Listed record set")
+		list[i] = &ResourceRecordSet{impl: &(r[i]), rrsets: &rrsets}
 	}
 
 	return list, err
@@ -64,32 +62,42 @@ func (rrsets ResourceRecordSets) List() ([]dnsprovider.ResourceRecordSet, error)
 
 // Get array of individual ResourceRecordSet items for the current zone
 func (rrsets ResourceRecordSets) Get(name string) ([]dnsprovider.ResourceRecordSet, error) {
-	if rrsets.zone != nil {
-		glog.V(5).Infof("GETTING  RecordSets for zone %q, requested %q", rrsets.zone.Name(), name)
-	} else {
-		glog.V(5).Infof("DANGER GETTING zone is nil\n")
-
-	}
-	rrsetList, err := rrsets.List()
-	arr := make([]dnsprovider.ResourceRecordSet, 0)
+	log := withFields(fieldZone, rrsets.zone.Name(), fieldName, name)
+	log.info(5, "Getting record sets")
 
+	relativeName := rrsets.relativeName(name)
+	svc := rrsets.zone.service()
+	rsets, err := svc.ListRecordSetsByNameWithContext(rrsets.zone.context(), rrsets.zone.Name(), relativeName, supportedRecordTypes)
 	if err != nil {
 		return nil, err
 	}
-	for _, rrset := range rrsetList {
-		glog.V(5).Infof("azuredns: ResourceRecrdSets Get looking for %q found %q\n", name, rrset.Name())
-		if rrset.Name() == name {
+
+	arr := make([]dnsprovider.ResourceRecordSet, 0)
+	for i := range *rsets {
+		rrset := &ResourceRecordSet{impl: &(*rsets)[i], rrsets: &rrsets}
+		if rrsets.relativeName(rrset.Name()) == relativeName {
 			arr = append(arr, rrsets.New(rrset.Name(), rrset.Rrdatas(), rrset.Ttl(), rrset.Type()))
 		}
 	}
 
-	glog.V(5).Infof("azuredns: ResourceRecrdSets Get for %q returned %i records\n", name, len(arr))
+	log.info(5, "Got record sets", "count", len(arr))
 	if len(arr) <= 0 {
 		return nil, nil
 	}
 	return arr, nil
 }
 
+// relativeName returns the name of a record set relative to the zone,
+// "@" for the zone apex
+func (rrsets ResourceRecordSets) relativeName(name string) string {
+	relativeName := strings.TrimSuffix(strings.TrimSuffix(name, "."), rrsets.zone.Name())
+	relativeName = strings.TrimSuffix(relativeName, ".")
+	if relativeName == "" {
+		return "@"
+	}
+	return relativeName
+}
+
 // StartChangeset implements dnsprovider.StartChangeset.
 // The returned Changeset holds manipulations of the DNS records.
 // The changes will be executed by calling the Apply function on the ResourceRecordChangeset interface
@@ -107,16 +115,15 @@ func (rrsets ResourceRecordSets) StartChangeset() dnsprovider.ResourceRecordChan
 func (rrsets ResourceRecordSets) New(name string, rrdatas []string, ttl int64, rrstype rrstype.RrsType) dnsprovider.ResourceRecordSet {
 	rrstypeStr := string(rrstype)
 
-	relativeName := strings.TrimSuffix(name, *rrsets.zone.impl.Name)
-	relativeName = strings.TrimSuffix(relativeName, ".")
+	relativeName := rrsets.relativeName(name)
 	rs := &dns.RecordSet{
 		Name: &relativeName,
 		Type: &rrstypeStr,
 	}
 
 	rrs := ResourceRecordSet{
-		rs,
-		&rrsets,
+		impl:   rs,
+		rrsets: &rrsets,
 	}
 	return rrs.setRecordSetProperties(ttl, rrdatas)
 }
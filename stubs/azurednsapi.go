@@ -18,7 +18,9 @@ limitations under the License.
 package azuredns
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
@@ -26,6 +28,9 @@ import (
 	"github.com/Azure/go-autorest/autorest/to"
 )
 
+// API abstracts the Azure DNS clients.
+// The WithContext variants of the methods return early with an error when ctx
+// is cancelled or its deadline expires.
 type API interface {
 	ListZones() (dns.ZoneListResult, error)
 	CreateOrUpdateZone(zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error)
@@ -33,6 +38,20 @@ type API interface {
 	ListResourceRecordSetsByZone(zoneName string) (*[]dns.RecordSet, error)
 	CreateOrUpdateRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error)
 	DeleteRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (result autorest.Response, err error)
+	// GetRecordSet returns the record set of the name and type, or an
+	// autorest.DetailedError with status 404 if it doesn't exist
+	GetRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error)
+	// ListRecordSetsByName returns the existing record sets of the name with one of the types
+	ListRecordSetsByName(zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error)
+
+	ListZonesWithContext(ctx context.Context) (dns.ZoneListResult, error)
+	CreateOrUpdateZoneWithContext(ctx context.Context, zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error)
+	DeleteZoneWithContext(ctx context.Context, zoneName string, ifMatch string) (dns.ZoneDeleteResult, error)
+	ListResourceRecordSetsByZoneWithContext(ctx context.Context, zoneName string) (*[]dns.RecordSet, error)
+	CreateOrUpdateRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error)
+	DeleteRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (autorest.Response, error)
+	GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error)
+	ListRecordSetsByNameWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error)
 }
 
 // Compile time check for interface conformance
@@ -91,11 +110,14 @@ func (a *MockAPI) CreateOrUpdateRecordSet(zoneName string, relativeRecordSetName
 		} else {
 			if ifNoneMatch == "*" {
 				// star parameter says no updates
-				return result, fmt.Errorf("parameters don't allow update")
+				return result, autorest.DetailedError{
+					StatusCode: http.StatusPreconditionFailed,
+					Message:    "parameters don't allow update",
+				}
 			}
 
 			// zone exists ... record exists
-			if *parameters.Etag != "" && a.recordSets[zoneName][found].Etag != parameters.Etag {
+			if parameters.Etag != nil && *parameters.Etag != "" && a.recordSets[zoneName][found].Etag != parameters.Etag {
 				return result, fmt.Errorf("Etag doesn't allow update")
 			}
 			// update record
@@ -144,15 +166,25 @@ func (a *MockAPI) ListZones() (dns.ZoneListResult, error) {
 // CreateOrUpdateZone simulates creating or updating a DNS zone
 func (a *MockAPI) CreateOrUpdateZone(zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error) {
 	id := zoneName
-	if _, ok := a.zones[id]; ok {
+	if existing, ok := a.zones[id]; ok {
 		// zone already exists
 		if ifNoneMatch == "*" {
 			// update not allowed because of *
 			return zone, fmt.Errorf("Error creating hosted DNS zone: %s already exists AND ", id)
 		}
+		// the assigned name servers are kept
+		if zone.ZoneProperties == nil {
+			zone.ZoneProperties = existing.ZoneProperties
+		}
 		a.zones[id] = &zone
 	} else {
-		// new zone
+		// new zone, Azure assigns the name servers
+		if zone.ZoneProperties == nil {
+			zone.ZoneProperties = &dns.ZoneProperties{}
+		}
+		if zone.NameServers == nil {
+			zone.NameServers = &[]string{"ns1-01.azure-dns.com.", "ns2-01.azure-dns.net."}
+		}
 		a.zones[id] = &zone
 		a.recordSets[id] = make([]dns.RecordSet, 0)
 	}
@@ -186,3 +218,97 @@ func (a *MockAPI) DeleteZone(zoneName string, ifMatch string, cancel <-chan stru
 	}
 	return result, err
 }
+
+// ListZonesWithContext returns the zones unless ctx is done
+func (a *MockAPI) ListZonesWithContext(ctx context.Context) (dns.ZoneListResult, error) {
+	if err := ctx.Err(); err != nil {
+		return dns.ZoneListResult{}, err
+	}
+	return a.ListZones()
+}
+
+// CreateOrUpdateZoneWithContext simulates creating or updating a DNS zone unless ctx is done
+func (a *MockAPI) CreateOrUpdateZoneWithContext(ctx context.Context, zoneName string, zone dns.Zone, ifMatch string, ifNoneMatch string) (dns.Zone, error) {
+	if err := ctx.Err(); err != nil {
+		return zone, err
+	}
+	return a.CreateOrUpdateZone(zoneName, zone, ifMatch, ifNoneMatch)
+}
+
+// DeleteZoneWithContext simulates deleting a zone unless ctx is done
+func (a *MockAPI) DeleteZoneWithContext(ctx context.Context, zoneName string, ifMatch string) (dns.ZoneDeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return dns.ZoneDeleteResult{}, err
+	}
+
+	results, errs := a.DeleteZone(zoneName, ifMatch, ctx.Done())
+	if err := <-errs; err != nil {
+		return dns.ZoneDeleteResult{}, err
+	}
+	return <-results, nil
+}
+
+// ListResourceRecordSetsByZoneWithContext returns the records from the mock API unless ctx is done
+func (a *MockAPI) ListResourceRecordSetsByZoneWithContext(ctx context.Context, zoneName string) (*[]dns.RecordSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.ListResourceRecordSetsByZone(zoneName)
+}
+
+// CreateOrUpdateRecordSetWithContext simulates creating or updating a record set unless ctx is done
+func (a *MockAPI) CreateOrUpdateRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, ifMatch string, ifNoneMatch string) (dns.RecordSet, error) {
+	if err := ctx.Err(); err != nil {
+		return parameters, err
+	}
+	return a.CreateOrUpdateRecordSet(zoneName, relativeRecordSetName, recordType, parameters, ifMatch, ifNoneMatch)
+}
+
+// DeleteRecordSetWithContext simulates deleting a record set unless ctx is done
+func (a *MockAPI) DeleteRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType, ifMatch string) (autorest.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return autorest.Response{}, err
+	}
+	return a.DeleteRecordSet(zoneName, relativeRecordSetName, recordType, ifMatch)
+}
+
+// GetRecordSet returns the record set of the name and type from the mock API
+func (a *MockAPI) GetRecordSet(zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	for _, r := range a.recordSets[zoneName] {
+		recType := strings.TrimPrefix(*r.Type, "Microsoft.Network/dnszones/")
+		if *r.Name == relativeRecordSetName && recType == string(recordType) {
+			return dns.RecordSet{Name: r.Name, ID: r.ID, Type: r.Type, RecordSetProperties: r.RecordSetProperties}, nil
+		}
+	}
+	return dns.RecordSet{}, autorest.DetailedError{
+		StatusCode: http.StatusNotFound,
+		Message:    fmt.Sprintf("record set %s of type %s not found in zone %s", relativeRecordSetName, recordType, zoneName),
+	}
+}
+
+// ListRecordSetsByName returns the record sets of the name with one of the types from the mock API
+func (a *MockAPI) ListRecordSetsByName(zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	arr := make([]dns.RecordSet, 0)
+	for _, recordType := range recordTypes {
+		if r, err := a.GetRecordSet(zoneName, relativeRecordSetName, recordType); err == nil {
+			arr = append(arr, r)
+		}
+	}
+	return &arr, nil
+}
+
+// GetRecordSetWithContext returns the record set of the name and type unless ctx is done
+func (a *MockAPI) GetRecordSetWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, error) {
+	if err := ctx.Err(); err != nil {
+		return dns.RecordSet{}, err
+	}
+	return a.GetRecordSet(zoneName, relativeRecordSetName, recordType)
+}
+
+// ListRecordSetsByNameWithContext returns the record sets of the name with one of the types unless ctx is done
+func (a *MockAPI) ListRecordSetsByNameWithContext(ctx context.Context, zoneName string, relativeRecordSetName string, recordTypes []dns.RecordType) (*[]dns.RecordSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.ListRecordSetsByName(zoneName, relativeRecordSetName, recordTypes)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// tokenRefreshWithin is how long before its expiry a token is refreshed
+const tokenRefreshWithin = 10 * time.Minute
+
+// Compile time check for interface adherence
+var _ adal.OAuthTokenProvider = &tokenProvider{}
+var _ adal.Refresher = &tokenProvider{}
+var _ adal.RefresherWithContext = &tokenProvider{}
+
+// tokenProvider is the single token shared by all clients of a DNSAPI.
+// Refresh is lazy: the first request within tokenRefreshWithin of the token's
+// expiry refreshes it, bounded by that request's context, so a token is replaced
+// before it becomes invalid as long as requests keep coming. An idle token is
+// not refreshed in the background. Refresh failures are passed to onRefreshError.
+type tokenProvider struct {
+	spt            *adal.ServicePrincipalToken
+	onRefreshError func(error)
+}
+
+func newTokenProvider(spt *adal.ServicePrincipalToken, onRefreshError func(error)) *tokenProvider {
+	spt.SetAutoRefresh(true)
+	spt.SetRefreshWithin(tokenRefreshWithin)
+	return &tokenProvider{
+		spt:            spt,
+		onRefreshError: onRefreshError,
+	}
+}
+
+// OAuthToken returns the current access token
+func (p *tokenProvider) OAuthToken() string {
+	return p.spt.OAuthToken()
+}
+
+// EnsureFresh refreshes the token if it expires within tokenRefreshWithin
+func (p *tokenProvider) EnsureFresh() error {
+	return p.observe(p.spt.EnsureFresh())
+}
+
+// EnsureFreshWithContext refreshes the token if it expires within
+// tokenRefreshWithin, giving up when ctx is done
+func (p *tokenProvider) EnsureFreshWithContext(ctx context.Context) error {
+	return p.observe(p.spt.EnsureFreshWithContext(ctx))
+}
+
+// Refresh unconditionally obtains a new token
+func (p *tokenProvider) Refresh() error {
+	return p.observe(p.spt.Refresh())
+}
+
+// RefreshExchange obtains a new token for a different resource
+func (p *tokenProvider) RefreshExchange(resource string) error {
+	return p.observe(p.spt.RefreshExchange(resource))
+}
+
+// RefreshWithContext unconditionally obtains a new token, giving up when ctx is done
+func (p *tokenProvider) RefreshWithContext(ctx context.Context) error {
+	return p.observe(p.spt.RefreshWithContext(ctx))
+}
+
+// RefreshExchangeWithContext obtains a new token for a different resource,
+// giving up when ctx is done
+func (p *tokenProvider) RefreshExchangeWithContext(ctx context.Context, resource string) error {
+	return p.observe(p.spt.RefreshExchangeWithContext(ctx, resource))
+}
+
+func (p *tokenProvider) observe(err error) error {
+	if err != nil && p.onRefreshError != nil {
+		p.onRefreshError(err)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// newTokenTestInterface returns an Interface authenticating against the given AAD endpoint
+func newTokenTestInterface(t *testing.T, aadURL string) *Interface {
+	config, err := loadConfig(testConfig("active-directory-endpoint = " + aadURL + "/\n"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	iface, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create interface: %v", err)
+	}
+	return iface
+}
+
+/* TestSharedToken verifies that the zones and record sets clients share one token */
+func TestSharedToken(t *testing.T) {
+	var requests int32
+	aad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"access_token":"shared","expires_in":"3600","expires_on":"4102444800","resource":"r","token_type":"Bearer"}`)
+	}))
+	defer aad.Close()
+
+	api := newTokenTestInterface(t, aad.URL).api
+	for _, authorizer := range []autorest.Authorizer{api.zc.Authorizer, api.rc.Authorizer, api.zc.Authorizer} {
+		if got := authorizationHeader(t, authorizer); got != "Bearer shared" {
+			t.Errorf("Got authorization %q", got)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("Got %d token requests, expected 1", requests)
+	}
+}
+
+/* TestTokenRefreshErrorHook verifies that refresh failures are passed to the hook */
+func TestTokenRefreshErrorHook(t *testing.T) {
+	aad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+	}))
+	defer aad.Close()
+
+	iface := newTokenTestInterface(t, aad.URL)
+	var failures []error
+	iface.OnTokenRefreshError(func(err error) {
+		failures = append(failures, err)
+	})
+
+	_, err := autorest.Prepare(&http.Request{}, autorest.WithBaseURL("https://example.com"), iface.api.zc.Authorizer.WithAuthorization())
+	if err == nil {
+		t.Errorf("Expected the request authorization to fail")
+	}
+	if len(failures) != 1 {
+		t.Errorf("Got %d refresh failures, expected 1", len(failures))
+	}
+}
+
+/* TestTokenRefreshHonorsContext verifies that a hung token refresh gives up with the request context */
+func TestTokenRefreshHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	aad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer aad.Close()
+	defer close(release)
+
+	iface := newTokenTestInterface(t, aad.URL)
+	var failures []error
+	iface.OnTokenRefreshError(func(err error) {
+		failures = append(failures, err)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	done := make(chan error, 1)
+	go func() {
+		_, err := autorest.Prepare(req.WithContext(ctx), iface.api.zc.Authorizer.WithAuthorization())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expected the request authorization to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Token refresh ignored the request context")
+	}
+	if len(failures) != 1 {
+		t.Errorf("Got %d refresh failures, expected 1", len(failures))
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns"
+
+// Span attribute keys
+const (
+	attrZone          = attribute.Key("azuredns.zone")
+	attrRecordName    = attribute.Key("azuredns.record.name")
+	attrRecordType    = attribute.Key("azuredns.record.type")
+	attrHTTPStatus    = attribute.Key("http.status_code")
+	attrRequestID     = attribute.Key("azure.request_id")
+	attrCorrelationID = attribute.Key("azure.correlation_id")
+	attrRemovals      = attribute.Key("azuredns.changeset.removals")
+	attrUpserts       = attribute.Key("azuredns.changeset.upserts")
+	attrAdditions     = attribute.Key("azuredns.changeset.additions")
+)
+
+// tracing holds the tracer provider of an Interface, shared by the DNSAPIs
+// of all its subscriptions. A nil *tracing uses the global provider.
+type tracing struct {
+	lock     sync.RWMutex
+	provider trace.TracerProvider
+}
+
+func (t *tracing) setProvider(provider trace.TracerProvider) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.provider = provider
+}
+
+// tracer returns the tracer of the configured provider,
+// of the global provider if none is configured
+func (t *tracing) tracer() trace.Tracer {
+	if t != nil {
+		t.lock.RLock()
+		provider := t.provider
+		t.lock.RUnlock()
+		if provider != nil {
+			return provider.Tracer(tracerName)
+		}
+	}
+	return otel.Tracer(tracerName)
+}
+
+// start opens a span named name as a child of the span in ctx
+func (t *tracing) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of an operation and ends its span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setResponseAttributes adds the HTTP status and the ARM request IDs of resp to span
+func setResponseAttributes(span trace.Span, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	span.SetAttributes(attrHTTPStatus.Int(resp.StatusCode))
+	if id := resp.Header.Get("x-ms-request-id"); id != "" {
+		span.SetAttributes(attrRequestID.String(id))
+	}
+	if id := resp.Header.Get("x-ms-correlation-request-id"); id != "" {
+		span.SetAttributes(attrCorrelationID.String(id))
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredns
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/kubernetes/federation/pkg/dnsprovider/rrstype"
+)
+
+// spanAttribute returns the value of the attribute key of span
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+/* TestTracing verifies the span hierarchy of an applied changeset */
+func TestTracing(t *testing.T) {
+	requests := 0
+	iface, closeAll := newARMTestInterface(t, "retry-max-attempts = 1\n", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-ms-request-id", fmt.Sprintf("request-%d", requests))
+		w.Header().Set("x-ms-correlation-request-id", "correlation")
+		fmt.Fprint(w, `{}`)
+	})
+	defer closeAll()
+	exporter := tracetest.NewInMemoryExporter()
+	iface.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	zones, _ := iface.Zones()
+	zone, _ := zones.New("test.com")
+	rrsets, _ := zone.ResourceRecordSets()
+	changeset := rrsets.StartChangeset()
+	changeset.Remove(rrsets.New("a.test.com", []string{"10.0.0.1"}, 180, rrstype.A))
+	changeset.Add(rrsets.New("b.test.com", []string{"10.0.0.2"}, 180, rrstype.A))
+	if err := changeset.Apply(); err != nil {
+		t.Fatalf("Failed to apply changeset: %v", err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	apply, ok := spans["azuredns.Apply"]
+	if !ok {
+		t.Fatalf("Got spans %v, expected an azuredns.Apply span", spans)
+	}
+	if n := spanAttribute(apply, attrRemovals).AsInt64(); n != 1 {
+		t.Errorf("Got %d removals on the Apply span, expected 1", n)
+	}
+
+	for change, call := range map[string]string{
+		"azuredns.Remove": "azuredns.DeleteRecordSet",
+		"azuredns.Add":    "azuredns.CreateOrUpdateRecordSet",
+	} {
+		changeSpan, ok := spans[change]
+		if !ok {
+			t.Errorf("Missing span %s", change)
+			continue
+		}
+		if changeSpan.Parent.SpanID() != apply.SpanContext.SpanID() {
+			t.Errorf("Span %s is not a child of the Apply span", change)
+		}
+		if zone := spanAttribute(changeSpan, attrZone).AsString(); zone != "test.com" {
+			t.Errorf("Got zone %q on span %s, expected test.com", zone, change)
+		}
+
+		callSpan, ok := spans[call]
+		if !ok {
+			t.Errorf("Missing span %s", call)
+			continue
+		}
+		if callSpan.Parent.SpanID() != changeSpan.SpanContext.SpanID() {
+			t.Errorf("Span %s is not a child of the span %s", call, change)
+		}
+		if id := spanAttribute(callSpan, attrRequestID).AsString(); id == "" {
+			t.Errorf("Missing the ARM request ID on span %s", call)
+		}
+		if id := spanAttribute(callSpan, attrCorrelationID).AsString(); id != "correlation" {
+			t.Errorf("Got correlation ID %q on span %s, expected correlation", id, call)
+		}
+		if typ := spanAttribute(callSpan, attrRecordType).AsString(); typ != "A" {
+			t.Errorf("Got record type %q on span %s, expected A", typ, call)
+		}
+	}
+}
+
+/* TestTracingLookupMiss verifies that a record set lookup answered with 404 doesn't mark its span as failed */
+func TestTracingLookupMiss(t *testing.T) {
+	iface, closeAll := newARMTestInterface(t, "retry-max-attempts = 1\n", nil)
+	defer closeAll()
+	exporter := tracetest.NewInMemoryExporter()
+	iface.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	if _, err := iface.service.GetRecordSet("test.com", "www", dns.A); !isNotFound(err) {
+		t.Fatalf("Got %v, expected a 404", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Status.Code != codes.Unset {
+		t.Errorf("Got spans %v, expected one span without error status", spans)
+	}
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package azuredns
 
 import (
+	"context"
+
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
+	azurestub "k8s.io/kubernetes/federation/pkg/dnsprovider/providers/azure/azuredns/stubs"
 )
 
 // Compile time check for interface adherence
@@ -30,6 +33,9 @@ var _ dnsprovider.Zone = &Zone{}
 type Zone struct {
 	impl  *dns.Zone
 	zones *Zones
+	// svc is the API of the subscription holding the zone, the
+	// default subscription if nil
+	svc azurestub.API
 }
 
 // Name is the implementation of Interface's Name method
@@ -43,6 +49,37 @@ func (zone *Zone) ID() string {
 	return *zone.impl.Name
 }
 
+// NameServers returns the Azure name servers assigned to the zone, nil for
+// zones that weren't read from or added to Azure
+func (zone *Zone) NameServers() []string {
+	if zone.impl.ZoneProperties == nil || zone.impl.NameServers == nil {
+		return nil
+	}
+	return *zone.impl.NameServers
+}
+
+// service returns the API of the subscription holding the zone
+func (zone *Zone) service() azurestub.API {
+	if zone.svc != nil {
+		return zone.svc
+	}
+	return zone.zones.impl.service
+}
+
+// ResourceGroup returns the Azure resource group owning the zone, parsed from
+// its ARM ID. It is empty for zones that weren't read from Azure.
+func (zone *Zone) ResourceGroup() string {
+	if zone.impl.ID == nil {
+		return ""
+	}
+	return resourceGroupFromID(*zone.impl.ID)
+}
+
+// context returns a context routing requests for the zone to its resource group
+func (zone *Zone) context() context.Context {
+	return withResourceGroup(context.Background(), zone.ResourceGroup())
+}
+
 // ResourceRecordSets is the implementation of the interfaces ResourceRecordSets method
 func (zone *Zone) ResourceRecordSets() (dnsprovider.ResourceRecordSets, bool) {
 	return &ResourceRecordSets{zone}, true
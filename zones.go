@@ -17,12 +17,19 @@ limitations under the License.
 package azuredns
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/Azure/azure-sdk-for-go/arm/dns"
 	"github.com/Azure/go-autorest/autorest/to"
-	"github.com/golang/glog"
 	"k8s.io/kubernetes/federation/pkg/dnsprovider"
+	"k8s.io/kubernetes/federation/pkg/dnsprovider/rrstype"
 )
 
+// delegationTTL is the TTL of the NS record sets created by AddDelegated
+const delegationTTL = 3600
+
 // Compile time check for interface adherence
 var _ dnsprovider.Zones = Zones{}
 
@@ -34,28 +41,33 @@ type Zones struct {
 	impl *Interface
 }
 
-// List returns all zones managed by this federation provider
+// List returns all zones managed by this federation provider,
+// aggregated across the configured subscriptions
 func (zones Zones) List() ([]dnsprovider.Zone, error) {
-	svc := zones.impl.service
-
-	azZoneList, err := svc.ListZones()
 	var zoneList []dnsprovider.Zone
 
-	if err == nil {
-		glog.V(5).Infof("azuredns: got %i zones\n", len(*azZoneList.Value))
+	for _, sub := range zones.impl.services() {
+		svc := sub.service
+
+		azZoneList, err := svc.ListZonesWithContext(context.Background())
+		if err != nil {
+			withFields(fieldSubscription, sub.name).error("Listing zones failed", err)
+			if sub.name != "" {
+				return nil, fmt.Errorf("subscription %q: %w", sub.name, err)
+			}
+			return nil, err
+		}
+
+		withFields(fieldSubscription, sub.name).info(5, "Listed zones", "count", len(*azZoneList.Value))
 		for i := range *azZoneList.Value {
 			zone := (*azZoneList.Value)[i]
-			zoneList = append(zoneList, &Zone{&zone, &zones})
-		}
-		// verifying
-		for _, z := range zoneList {
-			glog.V(5).Infof("azuredns: returning: %s\n", z.Name())
+			zoneList = append(zoneList, &Zone{impl: &zone, zones: &zones, svc: svc})
 		}
-	} else {
-		glog.V(5).Infof("azuredns: Error listing: %s\n", err.Error())
-		return nil, err
 	}
 
+	for _, z := range zoneList {
+		withFields(fieldZone, z.Name()).info(5, "Listed zone")
+	}
 	return zoneList, nil
 }
 
@@ -63,40 +75,180 @@ func (zones Zones) List() ([]dnsprovider.Zone, error) {
 func (zones Zones) Add(zone dnsprovider.Zone) (dnsprovider.Zone, error) {
 	zoneName := zone.Name()
 	svc := zones.impl.service
+	if z, ok := zone.(*Zone); ok {
+		svc = z.service()
+	}
 	zoneParam := &dns.Zone{
 		Location: to.StringPtr("global"),
 		Name:     to.StringPtr(zoneName),
 	}
 
-	_, err := svc.CreateOrUpdateZone(zoneName, *zoneParam, "", "")
+	created, err := svc.CreateOrUpdateZoneWithContext(context.Background(), zoneName, *zoneParam, "", "")
+	zones.impl.audit.record(zones.impl.auditEvent(svc, AuditAddZone, zoneName), err)
 
 	if err != nil {
-		glog.Errorf("Error creating Azure DNS zone: %s: %s", zoneName, err.Error())
+		withFields(fieldZone, zoneName, fieldOperation, "add").error("Could not create zone", err)
 		return nil, err
 	}
+	// the created zone's ID names its resource group
+	if created.ID != nil {
+		zoneParam.ID = created.ID
+	}
+	// and its properties hold the assigned name servers
+	zoneParam.ZoneProperties = created.ZoneProperties
 
 	return &Zone{
 		impl:  zoneParam,
-		zones: &zones}, nil
+		zones: &zones,
+		svc:   svc}, nil
+}
+
+// AddDelegated adds a child zone like Add and delegates it from its closest
+// parent zone in List, e.g. eu.fed.example.com from fed.example.com, by
+// upserting an NS record set of the child's Azure name servers in the parent.
+// The child zone is returned with the error if only the delegation fails.
+func (zones Zones) AddDelegated(zone dnsprovider.Zone) (dnsprovider.Zone, error) {
+	parent, err := zones.parentZone(zone.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	child, err := zones.Add(zone)
+	if err != nil {
+		return nil, err
+	}
+	nameServers := child.(*Zone).NameServers()
+	if len(nameServers) == 0 {
+		return child, fmt.Errorf("zone %s has no name servers to delegate to", child.Name())
+	}
+
+	rrsets, _ := parent.ResourceRecordSets()
+	ns := rrsets.New(child.Name(), nameServers, delegationTTL, rrstype.RrsType(dns.NS))
+	if err := rrsets.StartChangeset().Upsert(ns).Apply(); err != nil {
+		return child, fmt.Errorf("delegating %s from %s: %w", child.Name(), parent.Name(), err)
+	}
+	withFields(fieldZone, parent.Name(), fieldName, child.Name(), fieldType, dns.NS).
+		info(2, "Delegated zone", fieldRrdatas, nameServers)
+	return child, nil
+}
+
+// parentZone returns the listed zone with the longest name that is a
+// parent domain of name
+func (zones Zones) parentZone(name string) (dnsprovider.Zone, error) {
+	list, err := zones.List()
+	if err != nil {
+		return nil, err
+	}
+
+	parent := closestZone(list, name)
+	if parent == nil {
+		return nil, fmt.Errorf("%w: %s", ErrParentZoneNotFound, name)
+	}
+	return parent, nil
+}
+
+// closestZone returns the zone of list with the longest name that is a
+// parent domain of name, nil if there is none
+func closestZone(list []dnsprovider.Zone, name string) dnsprovider.Zone {
+	name = strings.TrimSuffix(name, ".")
+	var closest dnsprovider.Zone
+	closestName := ""
+	for _, zone := range list {
+		zoneName := strings.TrimSuffix(zone.Name(), ".")
+		if strings.HasSuffix(name, "."+zoneName) && len(zoneName) > len(closestName) {
+			closest, closestName = zone, zoneName
+		}
+	}
+	return closest
+}
+
+// UpsertReverseRecords upserts a PTR record set pointing to the name of an
+// A or AAAA record set for each of its addresses whose reverse zone, under
+// in-addr.arpa or ip6.arpa, is in List. Addresses without a managed reverse
+// zone are skipped.
+func (zones Zones) UpsertReverseRecords(rrset dnsprovider.ResourceRecordSet) error {
+	if t := rrset.Type(); t != rrstype.A && t != rrstype.AAAA {
+		return fmt.Errorf("%w: reverse records need an A or AAAA record set, got %s", ErrInvalidRecord, t)
+	}
+	target, err := normalizeFqdn(fqdn(rrset))
+	if err != nil {
+		return fmt.Errorf("%w: PTR target %v", ErrInvalidRecord, err)
+	}
+
+	list, err := zones.List()
+	if err != nil {
+		return err
+	}
+
+	// one changeset per reverse zone, applied in the order of the addresses
+	changesets := make(map[string]dnsprovider.ResourceRecordChangeset)
+	var order []string
+	for _, addr := range rrset.Rrdatas() {
+		name, err := reverseName(addr)
+		if err != nil {
+			return err
+		}
+		zone := closestZone(list, name)
+		if zone == nil {
+			withFields(fieldName, name, fieldType, dns.PTR).info(4, "No managed reverse zone, skipping the PTR record")
+			continue
+		}
+
+		changeset, ok := changesets[zone.Name()]
+		if !ok {
+			rrsets, _ := zone.ResourceRecordSets()
+			changeset = rrsets.StartChangeset()
+			changesets[zone.Name()] = changeset
+			order = append(order, zone.Name())
+		}
+		ptr := changeset.ResourceRecordSets().New(name, []string{target}, rrset.Ttl(), rrstype.RrsType(dns.PTR))
+		changeset.Upsert(ptr)
+	}
+
+	for _, zoneName := range order {
+		if err := changesets[zoneName].Apply(); err != nil {
+			return fmt.Errorf("reverse zone %s: %w", zoneName, err)
+		}
+	}
+	return nil
 }
 
 // Remove deletes a zone from Azure DNS
 func (zones Zones) Remove(zone dnsprovider.Zone) error {
 	svc := zones.impl.service
-	_, err := svc.DeleteZone(zone.Name(), "", nil)
-	errval := <-err
-	if errval != nil {
-		// TODO: Fix go azure sdk version
-		// Is now async
-		glog.V(0).Infof("Error Deleting Azure DNS Zone %s %v\n", zone.Name(), errval.Error())
-		return errval
+	// waits for the deletion to complete, bounded by the request timeout
+	ctx := context.Background()
+	if z, ok := zone.(*Zone); ok {
+		svc = z.service()
+		ctx = z.context()
+	}
+	_, err := svc.DeleteZoneWithContext(ctx, zone.Name(), "")
+	zones.impl.audit.record(zones.impl.auditEvent(svc, AuditRemoveZone, zone.Name()), err)
+	if err != nil {
+		withFields(fieldZone, zone.Name(), fieldOperation, "remove").error("Could not delete zone", err)
+		return err
 	}
 	return nil
 }
 
 // New initializes a new dnsprovider.Zone instance
-// to communicate with k8s federation
+// to communicate with k8s federation.
+// With several subscriptions the zone is looked up in List, so that its
+// changes are sent to the subscription holding it. Zones that don't exist
+// yet belong to the default subscription.
 func (zones Zones) New(name string) (dnsprovider.Zone, error) {
+	if len(zones.impl.subscriptions) > 1 {
+		list, err := zones.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, zone := range list {
+			if strings.EqualFold(strings.TrimSuffix(zone.Name(), "."), strings.TrimSuffix(name, ".")) {
+				return zone, nil
+			}
+		}
+	}
+
 	zone := dns.Zone{ID: &name, Name: &name}
-	return &Zone{&zone, &zones}, nil
+	return &Zone{impl: &zone, zones: &zones}, nil
 }